@@ -0,0 +1,225 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ricardobranco777/regview/imagefs"
+	"github.com/ricardobranco777/regview/local"
+	"github.com/ricardobranco777/regview/registry"
+	"github.com/ricardobranco777/regview/repoutils"
+)
+
+// splitImagePath splits an IMAGE[:PATH] argument where PATH is absolute
+func splitImagePath(arg string) (string, string) {
+	start := 0
+	if i := strings.Index(arg, "://"); i >= 0 {
+		start = i + len("://")
+	} else if local.IsLocal(arg) {
+		start = strings.Index(arg, ":") + 1
+	}
+	if i := strings.Index(arg[start:], ":/"); i >= 0 {
+		return arg[:start+i], arg[start+i+1:]
+	}
+	return arg, ""
+}
+
+// openImage returns the backend, repository & reference of an image in a registry or in a local store.
+// The repository may be omitted if the store has only one
+func openImage(ctx context.Context, image string) (registry.Backend, string, string, error) {
+	if !local.IsLocal(image) {
+		domain, repo, ref, err := parseImage(image)
+		if err != nil {
+			return nil, "", "", err
+		}
+		r, err := createRegistryClient(ctx, domain)
+		return r, repo, ref, err
+	}
+
+	store, path, err := local.Open(image)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if path == "" {
+		if repos, _ := store.Catalog(ctx, ""); len(repos) == 1 {
+			path = repos[0]
+		} else {
+			store.Close()
+			return nil, "", "", fmt.Errorf("%s: missing repository", image)
+		}
+	}
+	repo, ref, err := repoutils.GetRepoAndRef(path)
+	return store, repo, ref, err
+}
+
+// imageLayers returns the backend, repository & platform manifest of the image selected by --arch & --os
+func imageLayers(ctx context.Context, image string) (registry.Backend, string, *registry.Info, error) {
+	r, repo, ref, err := openImage(ctx, image)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	infos, err := getInfos(ctx, r, repo, ref)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("%s: %v", image, err)
+	}
+	switch len(infos) {
+	case 0:
+		return nil, "", nil, fmt.Errorf("%s: no manifest found for this platform", image)
+	case 1:
+		return r, repo, infos[0], nil
+	}
+	return nil, "", nil, fmt.Errorf("%s: %d platforms found. Use --arch & --os to select one", image, len(infos))
+}
+
+// openLayer returns the uncompressed tar stream of the layer.  The caller must close both
+func openLayer(ctx context.Context, r registry.Backend, repo string, digest string) (io.ReadCloser, io.ReadCloser, error) {
+	blob, err := r.GetBlob(ctx, repo, digest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s@%s: %v", repo, digest, err)
+	}
+	rd, err := imagefs.Decompress(blob)
+	if err != nil {
+		blob.Close()
+		return nil, nil, fmt.Errorf("%s@%s: %v", repo, digest, err)
+	}
+	return blob, rd, nil
+}
+
+// loadImageFS streams the layers of the image to build its filesystem
+func loadImageFS(ctx context.Context, r registry.Backend, repo string, info *registry.Info) (*imagefs.FS, error) {
+	fs := imagefs.New()
+	for _, layer := range info.Layers {
+		blob, rd, err := openLayer(ctx, r, repo, layer.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		err = fs.AddLayer(rd)
+		rd.Close()
+		blob.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s@%s: %v", repo, layer.Digest, err)
+		}
+	}
+	return fs, nil
+}
+
+// printEntry prints the entry like ls -l
+func printEntry(e *imagefs.Entry) {
+	size := prettySize(e.Size)
+	if opts.raw {
+		size = strconv.FormatInt(e.Size, 10)
+	}
+	name := e.Path
+	switch e.Typeflag {
+	case tar.TypeSymlink:
+		name += " -> " + e.Linkname
+	case tar.TypeLink:
+		name += " => /" + strings.TrimPrefix(e.Linkname, "/")
+	}
+	modTime := "-"
+	if !e.ModTime.IsZero() {
+		modTime = e.ModTime.In(tz).Format("2006-01-02 15:04")
+	}
+	fmt.Printf("%s %5d %5d %10s %s %s\n", e.FileInfo().Mode(), e.Uid, e.Gid, size, modTime, name)
+}
+
+// lsImage lists the file or the directory in the image
+func lsImage(ctx context.Context, arg string) {
+	image, p := splitImagePath(arg)
+	r, repo, info, err := imageLayers(ctx, image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs, err := loadImageFS(ctx, r, repo, info)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	e, err := fs.Stat(path.Join("/", p))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if e.Typeflag != tar.TypeDir {
+		printEntry(e)
+		return
+	}
+	entries, err := fs.ReadDir(e.Path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		printEntry(e)
+	}
+}
+
+// findImage lists the files under the path whose name, or path if the pattern has a slash, matches the pattern
+func findImage(ctx context.Context, arg string, pattern string) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		log.Fatalf("%s: %v\n", pattern, err)
+	}
+	image, p := splitImagePath(arg)
+	r, repo, info, err := imageLayers(ctx, image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs, err := loadImageFS(ctx, r, repo, info)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = fs.Walk(path.Join("/", p), func(e *imagefs.Entry) error {
+		name := path.Base(e.Path)
+		if strings.Contains(pattern, "/") {
+			name = e.Path
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			if opts.verbose {
+				printEntry(e)
+			} else {
+				fmt.Println(e.Path)
+			}
+		}
+		return ctx.Err()
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
+}
+
+// catImage prints the file in the image streaming its layer a second time
+func catImage(ctx context.Context, arg string) {
+	image, p := splitImagePath(arg)
+	if p == "" {
+		log.Fatalf("%s: missing path\n", arg)
+	}
+	r, repo, info, err := imageLayers(ctx, image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs, err := loadImageFS(ctx, r, repo, info)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	e, err := fs.Open(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	blob, rd, err := openLayer(ctx, r, repo, info.Layers[e.Layer].Digest.String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer blob.Close()
+	defer rd.Close()
+	if err := imagefs.Extract(rd, e, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+func Test_splitImagePath(t *testing.T) {
+	tests := []struct {
+		arg, image, path string
+	}{
+		{"registry.example.com/repo", "registry.example.com/repo", ""},
+		{"registry.example.com/repo:/etc", "registry.example.com/repo", "/etc"},
+		{"registry.example.com/repo:1.0:/etc/os-release", "registry.example.com/repo:1.0", "/etc/os-release"},
+		{"localhost:5000/repo:1.0:/", "localhost:5000/repo:1.0", "/"},
+		{"https://localhost:5000/repo@sha256:abcd:/etc", "https://localhost:5000/repo@sha256:abcd", "/etc"},
+		{"oci:/tmp/layout:/etc", "oci:/tmp/layout", "/etc"},
+		{"oci:/tmp/layout:1.0:/etc", "oci:/tmp/layout:1.0", "/etc"},
+		{"docker-archive:/tmp/image.tar:repo:1.0:/", "docker-archive:/tmp/image.tar:repo:1.0", "/"},
+	}
+	for _, test := range tests {
+		image, path := splitImagePath(test.arg)
+		if image != test.image || path != test.path {
+			t.Errorf("splitImagePath(%q) = %q, %q; want %q, %q", test.arg, image, path, test.image, test.path)
+		}
+	}
+}
+
+func Test_loadImageFS(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	r := f.client(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "etc/os-release", Typeflag: tar.TypeReg, Mode: 0644, Size: 10})
+	tw.Write([]byte("ID=alpine\n"))
+	tw.Close()
+	gw.Close()
+
+	info := &registry.Info{Layers: []oci.Descriptor{
+		{MediaType: oci.MediaTypeImageLayerGzip, Digest: digest.Digest(f.putBlob("repo", buf.Bytes())), Size: int64(buf.Len())},
+	}}
+	fs, err := loadImageFS(ctx, r, "repo", info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := fs.Stat("/etc/os-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Size != 10 || e.Layer != 0 {
+		t.Errorf("got %+v", e)
+	}
+}
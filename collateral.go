@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ricardobranco777/regview/registry"
+)
+
+// tagRef is what a tag resolves to
+type tagRef struct {
+	tag      string
+	digest   string
+	children []string // Digests of the manifests if digest is an index
+}
+
+// getTagRefs resolves all tags in the repository
+func getTagRefs(ctx context.Context, r *registry.Registry, repo string) ([]*tagRef, error) {
+	tags, err := r.Tags(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	tags = filterRegex(tags, ignoreTags, true)
+
+	var refs []*tagRef
+	var errs []error
+	var wg sync.WaitGroup
+	var m sync.Mutex
+
+	wg.Add(len(tags))
+	for _, tag := range tags {
+		go func(tag string) {
+			defer wg.Done()
+			ref, err := getTagRef(ctx, r, repo, tag)
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s:%s: %w", repo, tag, err))
+				return
+			}
+			refs = append(refs, ref)
+		}(tag)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	slices.SortFunc(refs, func(a, b *tagRef) int { return strings.Compare(a.tag, b.tag) })
+	return refs, nil
+}
+
+func getTagRef(ctx context.Context, r *registry.Registry, repo string, tag string) (*tagRef, error) {
+	m, err := r.GetManifest(ctx, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	children, err := m.Children()
+	if err != nil {
+		return nil, err
+	}
+	return &tagRef{tag: tag, digest: m.Digest, children: children}, nil
+}
+
+// findCollateral returns the tags other than ref that would be lost or broken by deleting the digests
+func findCollateral(ref string, digests []string, refs []*tagRef) []string {
+	var collateral []string
+	for _, r := range refs {
+		if r.tag == ref {
+			continue
+		}
+		if slices.Contains(digests, r.digest) {
+			collateral = append(collateral, fmt.Sprintf("%s points to %s", r.tag, r.digest))
+			continue
+		}
+		for _, child := range r.children {
+			if slices.Contains(digests, child) {
+				collateral = append(collateral, fmt.Sprintf("%s is an index containing %s", r.tag, child))
+			}
+		}
+	}
+	return collateral
+}
+
+// tagsFor returns the tags pointing to the digest
+func tagsFor(refs []*tagRef, digest string) []string {
+	var tags []string
+	for _, r := range refs {
+		if r.digest == digest {
+			tags = append(tags, r.tag)
+		}
+	}
+	return tags
+}
+
+// checkCollateral exits unless --force is used if deleting the digests would affect other tags.
+// It returns the tags in the repository
+func checkCollateral(ctx context.Context, r *registry.Registry, repo string, ref string, digests []string) []*tagRef {
+	refs, err := getTagRefs(ctx, r, repo)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !opts.force {
+			log.Fatalf("%v\nCan't check if other tags reference the digests. Use --force to delete anyway\n", err)
+		}
+		logError(ctx, "%v\n", err)
+		return nil
+	}
+
+	collateral := findCollateral(ref, digests, refs)
+	if len(collateral) == 0 {
+		return refs
+	}
+
+	if opts.force {
+		for _, c := range collateral {
+			fmt.Fprintf(os.Stderr, "WARNING: %s:%s\n", repo, c)
+		}
+		return refs
+	}
+	for _, c := range collateral {
+		log.Printf("%s:%s\n", repo, c)
+	}
+	log.Fatalf("Refusing to delete %s:%s as it would affect the tags above. Use --force to delete anyway\n", repo, ref)
+	return nil
+}
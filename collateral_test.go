@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_findCollateral(t *testing.T) {
+	refs := []*tagRef{
+		{tag: "1.4.2", digest: "sha256:index1", children: []string{"sha256:amd64", "sha256:arm64"}},
+		{tag: "stable", digest: "sha256:index1", children: []string{"sha256:amd64", "sha256:arm64"}},
+		{tag: "1.4", digest: "sha256:index2", children: []string{"sha256:amd64", "sha256:s390x"}},
+		{tag: "1.3", digest: "sha256:other"},
+	}
+
+	for _, tc := range []struct {
+		ref     string
+		digests []string
+		want    []string
+	}{
+		{
+			ref:     "1.4.2",
+			digests: []string{"sha256:index1"},
+			want:    []string{"stable points to sha256:index1"},
+		},
+		{
+			ref:     "1.4.2",
+			digests: []string{"sha256:amd64"},
+			want:    []string{"stable is an index containing sha256:amd64", "1.4 is an index containing sha256:amd64"},
+		},
+		{
+			ref:     "sha256:other",
+			digests: []string{"sha256:other"},
+			want:    []string{"1.3 points to sha256:other"},
+		},
+		{
+			ref:     "1.3",
+			digests: []string{"sha256:other"},
+		},
+	} {
+		got := findCollateral(tc.ref, tc.digests, refs)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("findCollateral(%s, %v) got %q; want %q", tc.ref, tc.digests, got, tc.want)
+		}
+	}
+}
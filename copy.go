@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ricardobranco777/regview/registry"
+)
+
+// copier copies images between repositories in the same or different registries
+type copier struct {
+	src, dst *registry.Registry
+	same     bool          // Same registry so blobs can be mounted
+	sem      chan struct{} // Limits the blobs being copied as each one needs a buffer and two requests
+}
+
+func newCopier(src *registry.Registry, dst *registry.Registry) *copier {
+	return &copier{src: src, dst: dst, same: src.Domain == dst.Domain, sem: make(chan struct{}, max(1, opts.jobs/2))}
+}
+
+// copyManifest puts the manifest as is under the new reference so indexes keep their digests.
+// When copying to another repository the manifests & blobs it references are copied first
+func (c *copier) copyManifest(ctx context.Context, srcRepo string, srcRef string, dstRepo string, dstRef string) (string, error) {
+	m, err := c.src.GetManifest(ctx, srcRepo, srcRef)
+	if err != nil {
+		return "", err
+	}
+
+	if !c.same || srcRepo != dstRepo {
+		if err := c.copyReferenced(ctx, m, srcRepo, dstRepo); err != nil {
+			return "", err
+		}
+	}
+
+	digest, err := c.dst.PutManifest(ctx, dstRepo, dstRef, m.MediaType, m.Data)
+	if err != nil {
+		return "", err
+	}
+	if digest != m.Digest {
+		return "", fmt.Errorf("digest mismatch: got %s, expected %s", digest, m.Digest)
+	}
+	return digest, nil
+}
+
+// copyReferenced copies the manifests of an index or the blobs of a manifest
+func (c *copier) copyReferenced(ctx context.Context, m *registry.Manifest, srcRepo string, dstRepo string) error {
+	if m.IsIndex() {
+		children, err := m.Children()
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if _, err := c.copyManifest(ctx, srcRepo, child, dstRepo, child); err != nil {
+				return fmt.Errorf("%s: %w", child, err)
+			}
+		}
+		return nil
+	}
+
+	blobs, err := m.Blobs()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	var errs []error
+
+	wg.Add(len(blobs))
+	for _, blob := range blobs {
+		go func(blob string) {
+			defer wg.Done()
+			if err := c.copyBlob(ctx, srcRepo, dstRepo, blob); err != nil {
+				l.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", blob, err))
+				l.Unlock()
+			}
+		}(blob)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// copyBlob copies the blob unless the destination already has it.
+// Blobs are mounted in the same registry and streamed between registries.
+// A client copying to itself spools the blob first as the download would
+// otherwise hold the request slot the upload is waiting for
+func (c *copier) copyBlob(ctx context.Context, srcRepo string, dstRepo string, blob string) error {
+	select {
+	case c.sem <- struct{}{}:
+		defer func() { <-c.sem }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if ok, err := c.dst.BlobExists(ctx, dstRepo, blob); err != nil || ok {
+		return err
+	}
+
+	if c.same {
+		ok, err := c.dst.MountBlob(ctx, dstRepo, blob, srcRepo)
+		if err != nil || ok {
+			return err
+		}
+	}
+
+	var rd io.ReadCloser
+	var err error
+	if c.src == c.dst {
+		rd, err = c.spoolBlob(ctx, srcRepo, blob)
+	} else {
+		rd, err = c.src.GetBlob(ctx, srcRepo, blob)
+	}
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	return c.dst.UploadBlobChunked(ctx, dstRepo, blob, rd, registry.DefaultChunkSize)
+}
+
+// spoolBlob downloads the blob to a temporary file that is removed when closed
+func (c *copier) spoolBlob(ctx context.Context, repo string, blob string) (io.ReadCloser, error) {
+	rd, err := c.src.GetBlob(ctx, repo, blob)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	f, err := os.CreateTemp("", "regview-")
+	if err != nil {
+		return nil, err
+	}
+	tmp := &tempFile{f}
+	if _, err := io.Copy(f, rd); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// tempFile is a temporary file removed on Close
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	return err
+}
+
+// copyJob is an image to copy
+type copyJob struct {
+	srcRepo, srcRef string
+	dstRepo, dstRef string
+}
+
+// copyImages copies SRC to DST.  SRC may have patterns in which case DST is a registry with an optional repository prefix
+func copyImages(ctx context.Context, src string, dst string) {
+	srcDomain, srcPath, err := parseImageArg(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dstDomain, dstPath, err := parseImageArg(dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var jobs []copyJob
+	isPattern := !strings.Contains(srcPath, "@") && strings.ContainsAny(srcPath, "*?[")
+	if isPattern {
+		if strings.ContainsAny(dstPath, ":@") {
+			log.Fatalf("%s: the destination must be a registry with an optional repository prefix when copying patterns\n", dst)
+		}
+		v := strings.SplitN(srcPath, ":", 2)
+		if repoRegex, err = globRegex(v[0]); err != nil {
+			log.Fatal(err)
+		}
+		if len(v) > 1 {
+			if tagRegex, err = globRegex(v[1]); err != nil {
+				log.Fatal(err)
+			}
+		}
+	} else {
+		job := copyJob{}
+		if _, job.srcRepo, job.srcRef, err = parseImage(src); err != nil {
+			log.Fatal(err)
+		}
+		job.dstRepo, job.dstRef = job.srcRepo, job.srcRef
+		if dstPath != "" {
+			if _, job.dstRepo, job.dstRef, err = parseImage(dst); err != nil {
+				log.Fatal(err)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+
+	srcReg, err := createRegistryClient(ctx, srcDomain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A separate client for the destination credentials still mounts blobs in the same registry
+	dstReg := srcReg
+	if dstDomain != srcDomain || opts.destUsername != "" {
+		if dstReg, err = newRegistryClient(ctx, dstDomain, opts.destUsername, opts.destPassword); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if isPattern {
+		if jobs, err = listCopyJobs(ctx, srcReg, strings.TrimSuffix(dstPath, "/")); err != nil {
+			logErrors(ctx, "", err)
+		}
+	}
+
+	c := newCopier(srcReg, dstReg)
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		srcImage := srcDomain + "/" + refString(job.srcRepo, job.srcRef)
+		dstImage := dstDomain + "/" + refString(job.dstRepo, job.dstRef)
+		fmt.Printf("Copying %s to %s\n", srcImage, dstImage)
+		if opts.dryRun {
+			continue
+		}
+		digest, err := c.copyManifest(ctx, job.srcRepo, job.srcRef, job.dstRepo, job.dstRef)
+		if err != nil {
+			logError(ctx, "%s: %v\n", srcImage, err)
+			continue
+		}
+		fmt.Printf("%s@%s\n", dstImage, digest)
+	}
+}
+
+// listCopyJobs returns the images matching repoRegex & tagRegex with their destination under the prefix.
+// It also returns the errors for the repositories whose tags couldn't be listed
+func listCopyJobs(ctx context.Context, r *registry.Registry, prefix string) ([]copyJob, error) {
+	repos, err := r.Catalog(ctx, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	repos = filterRegex(repos, repoRegex, false)
+	sort.Strings(repos)
+
+	var jobs []copyJob
+	var errs []error
+	for _, repo := range repos {
+		tags, err := r.Tags(ctx, repo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", repo, err))
+			continue
+		}
+		tags = filterRegex(tags, tagRegex, false)
+		tags = filterRegex(tags, ignoreTags, true)
+		sort.Strings(tags)
+
+		dstRepo := repo
+		if prefix != "" {
+			dstRepo = prefix + "/" + repo
+		}
+		for _, tag := range tags {
+			jobs = append(jobs, copyJob{srcRepo: repo, srcRef: tag, dstRepo: dstRepo, dstRef: tag})
+		}
+	}
+	return jobs, errors.Join(errs...)
+}
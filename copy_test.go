@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ricardobranco777/regview/registry"
+
+	types "github.com/moby/moby/api/types/registry"
+)
+
+func Test_copyManifest(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	r := f.client(t)
+	ctx := context.Background()
+
+	want := pushImage(f, "repo", "1.0")
+	c := newCopier(r, r)
+
+	// Same repository
+	got, err := c.copyManifest(ctx, "repo", "1.0", "repo", "stable")
+	if err != nil || got != want {
+		t.Fatalf("got %s, %v; want %s", got, err, want)
+	}
+
+	// Another repository mounts the blobs
+	got, err = c.copyManifest(ctx, "repo", "1.0", "other", "1.0")
+	if err != nil || got != want {
+		t.Fatalf("got %s, %v; want %s", got, err, want)
+	}
+	if f.mounts != 4 {
+		t.Errorf("got %d mounts; want 4", f.mounts)
+	}
+	m, err := r.GetManifest(ctx, "other", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, _ := m.Children()
+	for _, child := range children {
+		if _, err := r.GetManifest(ctx, "other", child); err != nil {
+			t.Errorf("%s: %v", child, err)
+		}
+	}
+}
+
+func Test_copyManifestNoMount(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	f.noMount = true
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A single request slot must be enough to copy the blobs the registry doesn't mount
+	r, err := registry.New(ctx, types.AuthConfig{ServerAddress: f.URL}, registry.Opt{Insecure: true, Jobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := opts.jobs
+	opts.jobs = 1
+	defer func() { opts.jobs = jobs }()
+
+	want := pushImage(f, "repo", "1.0")
+	got, err := newCopier(r, r).copyManifest(ctx, "repo", "1.0", "other", "1.0")
+	if err != nil || got != want {
+		t.Fatalf("got %s, %v; want %s", got, err, want)
+	}
+	for key, data := range f.blobs {
+		if repo, d, _ := strings.Cut(key, "@"); repo == "repo" && !bytes.Equal(f.blobs["other@"+d], data) {
+			t.Errorf("%s not copied", key)
+		}
+	}
+}
+
+func Test_copyManifestRegistries(t *testing.T) {
+	src, dst := newFakeRegistry(), newFakeRegistry()
+	defer src.Close()
+	defer dst.Close()
+	ctx := context.Background()
+
+	want := pushImage(src, "repo", "1.0")
+	// The destination already has a blob
+	dst.putBlob("mirror/repo", []byte("layer for amd64"))
+
+	c := newCopier(src.client(t), dst.client(t))
+	got, err := c.copyManifest(ctx, "repo", "1.0", "mirror/repo", "1.0")
+	if err != nil || got != want {
+		t.Fatalf("got %s, %v; want %s", got, err, want)
+	}
+
+	if len(dst.uploads) != 3 {
+		t.Errorf("got %d uploads; want 3", len(dst.uploads))
+	}
+	for key, data := range src.blobs {
+		key = "mirror/" + key
+		if !bytes.Equal(dst.blobs[key], data) {
+			t.Errorf("%s not copied", key)
+		}
+	}
+	if _, ok := dst.manifests["mirror/repo:1.0"]; !ok {
+		t.Error("tag not copied")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Cosign stores the signed payload as a layer of the signature manifest with the signature in an annotation
+const (
+	cosignSignatureType       = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	cosignPayloadType         = "application/vnd.dev.cosign.simplesigning.v1+json"
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	maxPayloadSize            = 1 << 20
+)
+
+// Signature status
+const (
+	signed   = "SIGNED"
+	unsigned = "UNSIGNED"
+	invalid  = "INVALID"
+)
+
+// verifyKey is the public key set with --verify-key
+var verifyKey *ecdsa.PublicKey
+
+// loadPublicKey loads a PEM encoded ECDSA public key like the cosign.pub created by cosign generate-key-pair
+func loadPublicKey(file string) (*ecdsa.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", file, key)
+	}
+	return pub, nil
+}
+
+// simpleSigning is the payload signed by cosign
+// https://github.com/containers/image/blob/main/docs/containers-signature.5.md
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// verifyPayload checks the base64 encoded signature of the payload and that the payload is for the digest
+func verifyPayload(key *ecdsa.PublicKey, payload []byte, signature string, dgst string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(key, hash[:], sig) {
+		return errors.New("invalid signature")
+	}
+
+	var ss simpleSigning
+	if err := json.Unmarshal(payload, &ss); err != nil {
+		return err
+	}
+	if ss.Critical.Image.DockerManifestDigest != dgst {
+		return fmt.Errorf("signature is for %s", ss.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
+
+// verifyLayer verifies a signature layer of a cosign signature manifest
+func verifyLayer(ctx context.Context, r *registry.Registry, repo string, layer oci.Descriptor, dgst string) error {
+	rc, err := r.GetBlob(ctx, repo, layer.Digest.String())
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(rc, maxPayloadSize+1))
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayloadSize {
+		return errors.New("payload too big")
+	}
+	if digest.FromBytes(payload) != layer.Digest {
+		return errors.New("payload digest mismatch")
+	}
+
+	return verifyPayload(verifyKey, payload, layer.Annotations[cosignSignatureAnnotation], dgst)
+}
+
+// verifyDigest returns the status of the cosign signatures of the digest found among its referrers
+func verifyDigest(ctx context.Context, r *registry.Registry, repo string, dgst string, referrers []oci.Descriptor) string {
+	status := unsigned
+	for _, d := range referrers {
+		if artifactType(d) != cosignSignatureType {
+			continue
+		}
+		m, err := r.GetManifest(ctx, repo, d.Digest.String())
+		if err != nil {
+			logError(ctx, "%s@%s: %v\n", repo, d.Digest, err)
+			continue
+		}
+		var manifest oci.Manifest
+		if err := manifest.UnmarshalJSON(m.Data); err != nil {
+			logError(ctx, "%s@%s: %v\n", repo, d.Digest, err)
+			continue
+		}
+		for _, layer := range manifest.Layers {
+			if layer.MediaType != cosignPayloadType || layer.Annotations[cosignSignatureAnnotation] == "" {
+				continue
+			}
+			if err := verifyLayer(ctx, r, repo, layer, dgst); err != nil {
+				if opts.debug {
+					log.Printf("%s@%s: %s: %v\n", repo, dgst, d.Digest, err)
+				}
+				status = invalid
+				continue
+			}
+			return signed
+		}
+	}
+	return status
+}
+
+// signatureStatus combines the status of the digests of an image.
+// Unknown status, when the referrers couldn't be fetched, take precedence over unsigned
+func signatureStatus(statuses ...string) string {
+	for _, status := range []string{signed, invalid, ""} {
+		for _, s := range statuses {
+			if s == status {
+				return s
+			}
+		}
+	}
+	return unsigned
+}
+
+// addSignatures sets the signature status of each info verifying the digests of the manifests & their indexes only once
+func addSignatures(ctx context.Context, r *registry.Registry, repo string, infos []*registry.Info, digest2Referrers map[string][]oci.Descriptor) {
+	digest2Status := make(map[string]string)
+
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	wg.Add(len(digest2Referrers))
+	for d, referrers := range digest2Referrers {
+		go func(d string, referrers []oci.Descriptor) {
+			defer wg.Done()
+			status := verifyDigest(ctx, r, repo, d, referrers)
+			m.Lock()
+			digest2Status[d] = status
+			m.Unlock()
+		}(d, referrers)
+	}
+	wg.Wait()
+
+	for _, info := range infos {
+		statuses := []string{digest2Status[info.Digest]}
+		if info.DigestAll != "" {
+			statuses = append(statuses, digest2Status[info.DigestAll])
+		}
+		info.Signature = signatureStatus(statuses...)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+)
+
+// pushSignature pushes a cosign signature of the digest signed with the key
+func pushSignature(t *testing.T, f *fakeRegistry, repo string, dgst string, key *ecdsa.PrivateKey) string {
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"` + repo + `"},"image":{"docker-manifest-digest":"` + dgst + `"},"type":"cosign container image signature"},"optional":null}`)
+	hash := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := f.putBlob(repo, payload)
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"digest":"%s","size":2},"layers":[{"mediaType":"%s","digest":"%s","size":%d,"annotations":{"%s":"%s"}}]}`,
+		oci.MediaTypeImageManifest, f.putBlob(repo, []byte("{}")), cosignPayloadType, layer, len(payload), cosignSignatureAnnotation, base64.StdEncoding.EncodeToString(sig))
+	tag := strings.Replace(dgst, ":", "-", 1) + ".sig"
+	f.putManifest(repo, tag, oci.MediaTypeImageManifest, []byte(manifest))
+	return tag
+}
+
+func Test_loadPublicKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := loadPublicKey(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(&key.PublicKey) {
+		t.Error("got a different key")
+	}
+
+	if err := os.WriteFile(file, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPublicKey(file); err == nil {
+		t.Error("expected error for invalid key")
+	}
+}
+
+func Test_addSignatures(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	r := f.client(t)
+	ctx := context.Background()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	saved, savedKey := opts, verifyKey
+	defer func() { opts, verifyKey = saved, savedKey }()
+	opts.referrers = false
+	verifyKey = &key.PublicKey
+
+	for _, test := range []struct {
+		repo string
+		key  *ecdsa.PrivateKey
+		want string
+	}{
+		{"signed", key, signed},
+		{"invalid", other, invalid},
+		{"unsigned", nil, unsigned},
+	} {
+		index := pushImage(f, test.repo, "1.0")
+		tags := []string{"1.0"}
+		if test.key != nil {
+			tags = append(tags, pushSignature(t, f, test.repo, index, test.key))
+		}
+		m, err := r.GetManifest(ctx, test.repo, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		children, _ := m.Children()
+		info := &registry.Info{Repo: test.repo, Ref: "1.0", Digest: children[0], DigestAll: index}
+
+		addArtifacts(ctx, r, test.repo, []*registry.Info{info}, tags)
+		if info.Signature != test.want {
+			t.Errorf("%s: got %q; want %q", test.repo, info.Signature, test.want)
+		}
+		if info.Referrers != nil {
+			t.Errorf("%s: referrers set without --referrers", test.repo)
+		}
+	}
+}
+
+func Test_signatureStatus(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{[]string{unsigned, signed}, signed},
+		{[]string{invalid, signed}, signed},
+		{[]string{invalid, unsigned}, invalid},
+		{[]string{"", unsigned}, ""},
+		{[]string{unsigned, unsigned}, unsigned},
+	}
+	for _, test := range tests {
+		if got := signatureStatus(test.statuses...); got != test.want {
+			t.Errorf("signatureStatus(%q) = %q; want %q", test.statuses, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ricardobranco777/regview/imagefs"
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	"gopkg.in/yaml.v3"
+)
+
+// change lists what was removed & added
+type change struct {
+	Removed []string `json:"removed,omitempty" yaml:"removed,omitempty"`
+	Added   []string `json:"added,omitempty" yaml:"added,omitempty"`
+}
+
+type layerChange struct {
+	Digest string `json:"digest" yaml:"digest"`
+	Size   int64  `json:"size" yaml:"size"`
+	Change string `json:"change" yaml:"change"` // shared, removed or added
+}
+
+type fileChange struct {
+	Path   string `json:"path" yaml:"path"`
+	Size   int64  `json:"size" yaml:"size"`
+	Change string `json:"change" yaml:"change"` // removed, added or changed
+}
+
+// imageDiff is the schema for diff --output
+type imageDiff struct {
+	From    string            `json:"from" yaml:"from"`
+	To      string            `json:"to" yaml:"to"`
+	Config  map[string]change `json:"config,omitempty" yaml:"config,omitempty"`
+	History change            `json:"history" yaml:"history"`
+	Layers  []layerChange     `json:"layers" yaml:"layers"`
+	Files   []fileChange      `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+// configFields are the compared fields of the config
+var configFields = []string{"Cmd", "Entrypoint", "Env", "ExposedPorts", "Labels", "User", "Volumes"}
+
+// configValues returns the compared fields of the config as lists of strings.
+// The command & entrypoint are compared as a whole
+func configValues(image *oci.Image) map[string][]string {
+	values := make(map[string][]string)
+	if image == nil {
+		return values
+	}
+	c := image.Config
+	for field, list := range map[string][]string{"Cmd": c.Cmd, "Entrypoint": c.Entrypoint} {
+		if len(list) > 0 {
+			data, _ := json.Marshal(list)
+			values[field] = []string{string(data)}
+		}
+	}
+	values["Env"] = c.Env
+	for k, v := range c.Labels {
+		values["Labels"] = append(values["Labels"], k+"="+v)
+	}
+	for port := range c.ExposedPorts {
+		values["ExposedPorts"] = append(values["ExposedPorts"], port)
+	}
+	for volume := range c.Volumes {
+		values["Volumes"] = append(values["Volumes"], volume)
+	}
+	if c.User != "" {
+		values["User"] = []string{c.User}
+	}
+	for _, list := range values {
+		sort.Strings(list)
+	}
+	return values
+}
+
+// diffStrings returns the strings only in a & those only in b keeping their order
+func diffStrings(a []string, b []string) change {
+	var c change
+	for _, s := range a {
+		if !slices.Contains(b, s) {
+			c.Removed = append(c.Removed, s)
+		}
+	}
+	for _, s := range b {
+		if !slices.Contains(a, s) {
+			c.Added = append(c.Added, s)
+		}
+	}
+	return c
+}
+
+// createdBy returns the commands in the history of the image
+func createdBy(image *oci.Image) []string {
+	if image == nil {
+		return nil
+	}
+	var commands []string
+	for _, h := range image.History {
+		commands = append(commands, strings.TrimSpace(h.CreatedBy))
+	}
+	return commands
+}
+
+// diffHistory returns the history entries after the common prefix as rebuilding a layer invalidates the next ones
+func diffHistory(a []string, b []string) change {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	var c change
+	if i < len(a) {
+		c.Removed = a[i:]
+	}
+	if i < len(b) {
+		c.Added = b[i:]
+	}
+	return c
+}
+
+// diffLayers returns the layers of b as shared or added followed by those removed from a
+func diffLayers(a []oci.Descriptor, b []oci.Descriptor) []layerChange {
+	inA := make(map[string]bool)
+	for _, layer := range a {
+		inA[layer.Digest.String()] = true
+	}
+	inB := make(map[string]bool)
+	var layers []layerChange
+	for _, layer := range b {
+		inB[layer.Digest.String()] = true
+		c := "added"
+		if inA[layer.Digest.String()] {
+			c = "shared"
+		}
+		layers = append(layers, layerChange{Digest: layer.Digest.String(), Size: layer.Size, Change: c})
+	}
+	for _, layer := range a {
+		if !inB[layer.Digest.String()] {
+			layers = append(layers, layerChange{Digest: layer.Digest.String(), Size: layer.Size, Change: "removed"})
+		}
+	}
+	return layers
+}
+
+// diffImages compares the configs, histories & layers of the images
+func diffImages(from string, to string, a *registry.Info, b *registry.Info) *imageDiff {
+	d := &imageDiff{
+		From:    from,
+		To:      to,
+		Config:  make(map[string]change),
+		History: diffHistory(createdBy(a.Image), createdBy(b.Image)),
+		Layers:  diffLayers(a.Layers, b.Layers),
+	}
+	valuesA, valuesB := configValues(a.Image), configValues(b.Image)
+	for _, field := range configFields {
+		if c := diffStrings(valuesA[field], valuesB[field]); len(c.Removed) > 0 || len(c.Added) > 0 {
+			d.Config[field] = c
+		}
+	}
+	return d
+}
+
+// fileEntries returns the entries in the filesystem by path
+func fileEntries(fs *imagefs.FS) map[string]*imagefs.Entry {
+	entries := make(map[string]*imagefs.Entry)
+	fs.Walk("/", func(e *imagefs.Entry) error {
+		entries[e.Path] = e
+		return nil
+	})
+	return entries
+}
+
+// sameEntry returns true if the type, size, mode, owner, link target & modification time are the same
+func sameEntry(a *imagefs.Entry, b *imagefs.Entry) bool {
+	return a.Typeflag == b.Typeflag && a.Size == b.Size && a.Mode == b.Mode && a.Uid == b.Uid && a.Gid == b.Gid &&
+		a.Linkname == b.Linkname && a.ModTime.Equal(b.ModTime)
+}
+
+// diffFiles compares the merged filesystems of the images
+func diffFiles(a *imagefs.FS, b *imagefs.FS) []fileChange {
+	entriesA, entriesB := fileEntries(a), fileEntries(b)
+	var paths []string
+	for p := range entriesA {
+		paths = append(paths, p)
+	}
+	for p := range entriesB {
+		if _, ok := entriesA[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var files []fileChange
+	for _, p := range paths {
+		ea, inA := entriesA[p]
+		eb, inB := entriesB[p]
+		switch {
+		case p == "/":
+		case !inB:
+			files = append(files, fileChange{Path: p, Size: ea.Size, Change: "removed"})
+		case !inA:
+			files = append(files, fileChange{Path: p, Size: eb.Size, Change: "added"})
+		case !sameEntry(ea, eb):
+			files = append(files, fileChange{Path: p, Size: eb.Size, Change: "changed"})
+		}
+	}
+	return files
+}
+
+// printChange prints the removed & added strings
+func printChange(name string, c change) {
+	if len(c.Removed) == 0 && len(c.Added) == 0 {
+		return
+	}
+	fmt.Println(name)
+	for _, s := range c.Removed {
+		fmt.Printf("  - %s\n", s)
+	}
+	for _, s := range c.Added {
+		fmt.Printf("  + %s\n", s)
+	}
+}
+
+// printDiff prints the differences like a unified diff with a summary of the layers
+func printDiff(d *imageDiff) {
+	fmt.Printf("--- %s\n+++ %s\n", d.From, d.To)
+	for _, field := range configFields {
+		printChange(field, d.Config[field])
+	}
+	printChange("History", d.History)
+
+	fmt.Println("Layers")
+	counts := make(map[string]int)
+	sizes := make(map[string]int64)
+	for _, layer := range d.Layers {
+		prefix := map[string]string{"shared": " ", "removed": "-", "added": "+"}[layer.Change]
+		fmt.Printf("  %s %s %s\n", prefix, layer.Digest, formatSize(layer.Size))
+		counts[layer.Change]++
+		sizes[layer.Change] += layer.Size
+	}
+	var summary []string
+	for _, c := range []string{"shared", "removed", "added"} {
+		summary = append(summary, fmt.Sprintf("%d %s (%s)", counts[c], c, formatSize(sizes[c])))
+	}
+	fmt.Printf("  %s\n", strings.Join(summary, ", "))
+
+	if d.Files != nil {
+		fmt.Println("Files")
+		for _, f := range d.Files {
+			// Same letters as docker diff
+			letter := map[string]string{"removed": "D", "added": "A", "changed": "C"}[f.Change]
+			fmt.Printf("  %s %s\n", letter, f.Path)
+		}
+	}
+}
+
+// writeDiff writes the differences in the --output format
+func writeDiff(d *imageDiff) error {
+	var data []byte
+	var err error
+	switch opts.output {
+	case "json":
+		data, err = json.MarshalIndent(d, "", "  ")
+	case "ndjson":
+		data, err = json.Marshal(d)
+	case "yaml":
+		data, err = yaml.Marshal(d)
+	default:
+		return fmt.Errorf("diff doesn't support --output %s", opts.output)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(strings.TrimSuffix(string(data), "\n"))
+	return err
+}
+
+// diffImage compares the images selected by --arch & --os and their files with --files
+func diffImage(ctx context.Context, from string, to string) {
+	if opts.output == "csv" {
+		log.Fatal("diff doesn't support --output csv")
+	}
+	type image struct {
+		r    registry.Backend
+		repo string
+		info *registry.Info
+	}
+	var images []image
+	for _, arg := range []string{from, to} {
+		r, repo, info, err := imageLayers(ctx, arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if info.Image, err = r.GetImage(ctx, repo, info.ID); err != nil {
+			log.Fatalf("%s: %v\n", arg, err)
+		}
+		images = append(images, image{r, repo, info})
+	}
+
+	d := diffImages(from, to, images[0].info, images[1].info)
+	if opts.files {
+		var fs []*imagefs.FS
+		for _, image := range images {
+			f, err := loadImageFS(ctx, image.r, image.repo, image.info)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fs = append(fs, f)
+		}
+		d.Files = diffFiles(fs[0], fs[1])
+	}
+
+	if opts.output != "" {
+		if err := writeDiff(d); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printDiff(d)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ricardobranco777/regview/imagefs"
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+func Test_diffImages(t *testing.T) {
+	layer := func(s string, size int64) oci.Descriptor {
+		return oci.Descriptor{Digest: digest.FromString(s), Size: size}
+	}
+	a := &registry.Info{
+		Image: &oci.Image{
+			Config: oci.ImageConfig{
+				Env:          []string{"PATH=/bin", "VERSION=1.3"},
+				Cmd:          []string{"/app"},
+				Labels:       map[string]string{"version": "1.3", "vendor": "me"},
+				ExposedPorts: map[string]struct{}{"80/tcp": {}},
+			},
+			History: []oci.History{{CreatedBy: "ADD rootfs /"}, {CreatedBy: "COPY app /app"}},
+		},
+		Layers: []oci.Descriptor{layer("base", 100), layer("app-1.3", 10)},
+	}
+	b := &registry.Info{
+		Image: &oci.Image{
+			Config: oci.ImageConfig{
+				Env:          []string{"PATH=/bin", "VERSION=1.4"},
+				Cmd:          []string{"/app", "--serve"},
+				Labels:       map[string]string{"version": "1.4", "vendor": "me"},
+				ExposedPorts: map[string]struct{}{"80/tcp": {}},
+				User:         "app",
+			},
+			History: []oci.History{{CreatedBy: "ADD rootfs /"}, {CreatedBy: "COPY app /app"}, {CreatedBy: "USER app", EmptyLayer: true}},
+		},
+		Layers: []oci.Descriptor{layer("base", 100), layer("app-1.4", 12)},
+	}
+
+	d := diffImages("repo:1.3", "repo:1.4", a, b)
+	wantConfig := map[string]change{
+		"Cmd":    {Removed: []string{`["/app"]`}, Added: []string{`["/app","--serve"]`}},
+		"Env":    {Removed: []string{"VERSION=1.3"}, Added: []string{"VERSION=1.4"}},
+		"Labels": {Removed: []string{"version=1.3"}, Added: []string{"version=1.4"}},
+		"User":   {Added: []string{"app"}},
+	}
+	if !reflect.DeepEqual(d.Config, wantConfig) {
+		t.Errorf("got config %+v; want %+v", d.Config, wantConfig)
+	}
+	if want := (change{Added: []string{"USER app"}}); !reflect.DeepEqual(d.History, want) {
+		t.Errorf("got history %+v; want %+v", d.History, want)
+	}
+	wantLayers := []layerChange{
+		{Digest: digest.FromString("base").String(), Size: 100, Change: "shared"},
+		{Digest: digest.FromString("app-1.4").String(), Size: 12, Change: "added"},
+		{Digest: digest.FromString("app-1.3").String(), Size: 10, Change: "removed"},
+	}
+	if !reflect.DeepEqual(d.Layers, wantLayers) {
+		t.Errorf("got layers %+v; want %+v", d.Layers, wantLayers)
+	}
+}
+
+func Test_diffFiles(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	makeFS := func(files map[string]string) *imagefs.FS {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range []string{"bin/app", "etc/config", "etc/old", "etc/new"} {
+			data, ok := files[name]
+			if !ok {
+				continue
+			}
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data)), ModTime: modTime})
+			tw.Write([]byte(data))
+		}
+		tw.Close()
+		fs := imagefs.New()
+		if err := fs.AddLayer(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+
+	a := makeFS(map[string]string{"bin/app": "v1", "etc/config": "a=1", "etc/old": "x"})
+	b := makeFS(map[string]string{"bin/app": "v2", "etc/config": "a=12", "etc/new": "y"})
+	want := []fileChange{
+		{Path: "/etc/config", Size: 4, Change: "changed"},
+		{Path: "/etc/new", Size: 1, Change: "added"},
+		{Path: "/etc/old", Size: 1, Change: "removed"},
+	}
+	if got := diffFiles(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
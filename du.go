@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	concurrently "github.com/tejzpr/ordered-concurrently/v3"
+)
+
+// usage is the deduplicated size of a tag, a repository or the registry.
+// Exclusive is what deleting it alone would free
+type usage struct {
+	Name      string
+	Size      int64
+	Exclusive int64
+}
+
+// addBlobs adds the raw index or manifest and the blobs it references by digest.
+// The platform manifests not matching the architectures & OSes are skipped along with their attestation manifests.
+// Foreign layers are skipped as they're not stored in the registry
+func addBlobs(ctx context.Context, b registry.Backend, repo string, ref string, arches []string, oses []string, blobs map[string]int64) error {
+	m, err := b.GetManifest(ctx, repo, ref)
+	if err != nil {
+		return err
+	}
+	blobs[m.Digest] = int64(len(m.Data))
+
+	if m.IsIndex() {
+		var index oci.Index
+		if err := index.UnmarshalJSON(m.Data); err != nil {
+			return err
+		}
+		attestations := registry.AttestationDigests(&index)
+		for _, manifest := range index.Manifests {
+			if registry.SkipPlatform(manifest.Platform, arches, oses) {
+				continue
+			}
+			children := []string{manifest.Digest.String()}
+			if d, ok := attestations[manifest.Digest.String()]; ok {
+				children = append(children, d)
+			}
+			for _, child := range children {
+				if err := addBlobs(ctx, b, repo, child, arches, oses, blobs); err != nil {
+					return fmt.Errorf("%s: %w", child, err)
+				}
+			}
+		}
+		return nil
+	}
+
+	var manifest oci.Manifest
+	if err := manifest.UnmarshalJSON(m.Data); err != nil {
+		return err
+	}
+	blobs[manifest.Config.Digest.String()] = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		if len(layer.URLs) == 0 {
+			blobs[layer.Digest.String()] = layer.Size
+		}
+	}
+	return nil
+}
+
+// duWorker gets the blobs of the tags in a repository.
+// Signature, attestation & referrer tags are included as they take storage too
+type duWorker struct {
+	reg  registry.Backend
+	repo string
+}
+
+func (w *duWorker) Run(ctx context.Context) any {
+	tags, err := w.reg.Tags(ctx, w.repo)
+	if err != nil {
+		logError(ctx, "%s: %v\n", w.repo, err)
+		return map[string]map[string]int64{}
+	}
+	tags = filterRegex(tags, tagRegex, false)
+
+	tag2Blobs := make(map[string]map[string]int64)
+	var wg sync.WaitGroup
+	var m sync.Mutex
+
+	wg.Add(len(tags))
+	for _, tag := range tags {
+		go func(tag string) {
+			defer wg.Done()
+			blobs := make(map[string]int64)
+			if err := addBlobs(ctx, w.reg, w.repo, tag, opts.arch, opts.os, blobs); err != nil {
+				logError(ctx, "%s:%s: %v\n", w.repo, tag, err)
+				return
+			}
+			m.Lock()
+			tag2Blobs[tag] = blobs
+			m.Unlock()
+		}(tag)
+	}
+	wg.Wait()
+
+	return tag2Blobs
+}
+
+// sumSizes returns the size of the blobs and of those referenced only once
+func sumSizes(blobs map[string]int64, refs map[string]map[string]bool) (size int64, exclusive int64) {
+	for d, n := range blobs {
+		size += n
+		if len(refs[d]) == 1 {
+			exclusive += n
+		}
+	}
+	return size, exclusive
+}
+
+// diskUsage returns the usage of each tag followed by that of its repository, and the usage of all of them
+// from the blobs of the tags by repository.  Blobs shared by several tags or repositories are counted once
+func diskUsage(tags map[string]map[string]map[string]int64) ([]usage, usage) {
+	// Tags & repositories referencing each blob
+	tagRefs := make(map[string]map[string]bool)
+	repoRefs := make(map[string]map[string]bool)
+	repoBlobs := make(map[string]map[string]int64)
+	all := make(map[string]int64)
+	var repos []string
+	for repo := range tags {
+		repos = append(repos, repo)
+		repoBlobs[repo] = make(map[string]int64)
+		for tag, blobs := range tags[repo] {
+			for d, n := range blobs {
+				if tagRefs[d] == nil {
+					tagRefs[d] = make(map[string]bool)
+					repoRefs[d] = make(map[string]bool)
+				}
+				tagRefs[d][repo+":"+tag] = true
+				repoRefs[d][repo] = true
+				repoBlobs[repo][d] = n
+				all[d] = n
+			}
+		}
+	}
+	sort.Strings(repos)
+
+	var usages []usage
+	for _, repo := range repos {
+		var names []string
+		for tag := range tags[repo] {
+			names = append(names, tag)
+		}
+		sort.Strings(names)
+		for _, tag := range names {
+			size, exclusive := sumSizes(tags[repo][tag], tagRefs)
+			usages = append(usages, usage{Name: repo + ":" + tag, Size: size, Exclusive: exclusive})
+		}
+		size, exclusive := sumSizes(repoBlobs[repo], repoRefs)
+		usages = append(usages, usage{Name: repo, Size: size, Exclusive: exclusive})
+	}
+
+	total, _ := sumSizes(all, nil)
+	return usages, usage{Size: total, Exclusive: total}
+}
+
+// duAll prints the deduplicated size & the exclusive size of each tag & repository, and the total
+func duAll(ctx context.Context, domain string) {
+	r, repos := listRepos(ctx, domain)
+	repoWidth = getMax(repos)
+
+	inputChan := make(chan concurrently.WorkFunction)
+	output := concurrently.Process(ctx, inputChan, &concurrently.Options{PoolSize: opts.jobs, OutChannelBuffer: opts.jobs})
+
+	go func() {
+		defer close(inputChan)
+		for _, repo := range repos {
+			select {
+			case inputChan <- &duWorker{reg: r, repo: repo}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The output is in the order of the repositories
+	tags := make(map[string]map[string]map[string]int64)
+	var i int
+	for out := range output {
+		if tag2Blobs := out.Value.(map[string]map[string]int64); len(tag2Blobs) > 0 {
+			tags[repos[i]] = tag2Blobs
+		}
+		i++
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	usages, total := diskUsage(tags)
+	total.Name = domain
+	format := "%-*s  %10s  %10s\n"
+	fmt.Printf(format, repoWidth+20, "REPOSITORY:TAG", "SIZE", "EXCLUSIVE")
+	for _, u := range append(usages, total) {
+		fmt.Printf(format, repoWidth+20, u.Name, formatSize(u.Size), formatSize(u.Exclusive))
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+func Test_addBlobs(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	ctx := context.Background()
+
+	saved := opts
+	defer func() { opts = saved }()
+
+	d := func(s string) string {
+		return digest.FromString(s).String()
+	}
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"digest":"%s","size":1},"layers":[{"digest":"%s","size":2},{"digest":"%s","size":5000,"urls":["https://example.com"]}]}`,
+		oci.MediaTypeImageManifest, d("config"), d("layer"), d("foreign"))
+	m := f.putManifest("repo", "", oci.MediaTypeImageManifest, []byte(manifest))
+	attestation := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"digest":"%s","size":3},"layers":[{"digest":"%s","size":4}]}`,
+		oci.MediaTypeImageManifest, d("attestation-config"), d("attestation-layer"))
+	a := f.putManifest("repo", "", oci.MediaTypeImageManifest, []byte(attestation))
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[{"mediaType":"%s","digest":"%s","size":%d,"platform":{"architecture":"amd64","os":"linux"}},{"mediaType":"%s","digest":"%s","size":%d,"platform":{"architecture":"unknown","os":"unknown"},"annotations":{"vnd.docker.reference.type":"attestation-manifest","vnd.docker.reference.digest":"%s"}}]}`,
+		oci.MediaTypeImageIndex, oci.MediaTypeImageManifest, m, len(manifest), oci.MediaTypeImageManifest, a, len(attestation), m)
+	i := f.putManifest("repo", "1.0", oci.MediaTypeImageIndex, []byte(index))
+
+	// The attestation manifest is counted with its platform manifest
+	blobs := make(map[string]int64)
+	if err := addBlobs(ctx, f.client(t), "repo", "1.0", opts.arch, opts.os, blobs); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{
+		i:                       int64(len(index)),
+		m:                       int64(len(manifest)),
+		d("config"):             1,
+		d("layer"):              2,
+		a:                       int64(len(attestation)),
+		d("attestation-config"): 3,
+		d("attestation-layer"):  4,
+	}
+	if !reflect.DeepEqual(blobs, want) {
+		t.Errorf("got %v; want %v", blobs, want)
+	}
+
+	opts.arch = []string{"arm64"}
+	blobs = make(map[string]int64)
+	if err := addBlobs(ctx, f.client(t), "repo", "1.0", opts.arch, opts.os, blobs); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{i: int64(len(index))}; !reflect.DeepEqual(blobs, want) {
+		t.Errorf("got %v; want %v", blobs, want)
+	}
+}
+
+func Test_diskUsage(t *testing.T) {
+	d := func(s string) string {
+		return digest.FromString(s).String()
+	}
+	image := func(name string, layers map[string]int64) map[string]int64 {
+		blobs := map[string]int64{d(name + "-manifest"): 1, d(name + "-config"): 10}
+		for layer, size := range layers {
+			blobs[d(layer)] = size
+		}
+		return blobs
+	}
+
+	tags := map[string]map[string]map[string]int64{
+		"app": {
+			"1.0":    image("app-1.0", map[string]int64{"base": 1000, "app-1.0": 100}),
+			"latest": image("app-1.1", map[string]int64{"base": 1000, "app-1.1": 200}),
+			"1.1":    image("app-1.1", map[string]int64{"base": 1000, "app-1.1": 200}),
+		},
+		"db": {
+			"1.0": image("db-1.0", map[string]int64{"base": 1000, "db-1.0": 400}),
+		},
+		"win": {
+			"1.0": image("win-1.0", nil),
+		},
+	}
+
+	usages, total := diskUsage(tags)
+	want := []usage{
+		{Name: "app:1.0", Size: 1111, Exclusive: 111},
+		{Name: "app:1.1", Size: 1211, Exclusive: 0},
+		{Name: "app:latest", Size: 1211, Exclusive: 0},
+		{Name: "app", Size: 1322, Exclusive: 322},
+		{Name: "db:1.0", Size: 1411, Exclusive: 411},
+		{Name: "db", Size: 1411, Exclusive: 411},
+		{Name: "win:1.0", Size: 11, Exclusive: 11},
+		{Name: "win", Size: 11, Exclusive: 11},
+	}
+	if !reflect.DeepEqual(usages, want) {
+		t.Errorf("got %+v; want %+v", usages, want)
+	}
+	if total.Size != 1744 {
+		t.Errorf("got total %d; want 1744", total.Size)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ricardobranco777/regview/imagefs"
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// openEmptyDir creates the directory if needed & refuses to write to a directory that's not empty
+func openEmptyDir(dir string) (*os.Root, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("%s: directory not empty", dir)
+	}
+	return os.OpenRoot(dir)
+}
+
+// exportRootFS flattens the layers of the image into the directory
+func exportRootFS(ctx context.Context, r registry.Backend, repo string, info *registry.Info, root *os.Root) error {
+	u := imagefs.NewUnpacker(root, os.Geteuid() == 0)
+	for _, layer := range info.Layers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		blob, rd, err := openLayer(ctx, r, repo, layer.Digest.String())
+		if err != nil {
+			return err
+		}
+		err = u.AddLayer(rd)
+		rd.Close()
+		blob.Close()
+		if err != nil {
+			return fmt.Errorf("%s@%s: %v", repo, layer.Digest, err)
+		}
+	}
+	return u.Close()
+}
+
+// blobPath returns the path of the blob in an OCI image layout
+func blobPath(d digest.Digest) string {
+	return path.Join(oci.ImageBlobsDir, d.Algorithm().String(), d.Encoded())
+}
+
+// writeBlob streams the blob to the OCI image layout verifying its digest
+func writeBlob(ctx context.Context, r registry.Backend, repo string, d digest.Digest, root *os.Root) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	dst := blobPath(d)
+	if err := root.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	rc, err := r.GetBlob(ctx, repo, d.String())
+	if err != nil {
+		return fmt.Errorf("%s@%s: %v", repo, d, err)
+	}
+	defer rc.Close()
+
+	tmp := dst + ".tmp"
+	f, err := root.Create(tmp)
+	if err != nil {
+		return err
+	}
+	verifier := d.Verifier()
+	_, err = io.Copy(io.MultiWriter(f, verifier), rc)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil && !verifier.Verified() {
+		err = fmt.Errorf("%s@%s: digest mismatch", repo, d)
+	}
+	if err != nil {
+		root.Remove(tmp)
+		return err
+	}
+	return root.Rename(tmp, dst)
+}
+
+// exportLayout writes the platform manifest of the image with its blobs as an OCI image layout
+// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+func exportLayout(ctx context.Context, r registry.Backend, repo string, info *registry.Info, root *os.Root) error {
+	m, err := r.GetManifest(ctx, repo, cmp.Or(info.Digest, info.Ref))
+	if err != nil {
+		return fmt.Errorf("%s: %v", refString(repo, info.Ref), err)
+	}
+	blobs, err := m.Blobs()
+	if err != nil {
+		return err
+	}
+	for _, d := range blobs {
+		if err := writeBlob(ctx, r, repo, digest.Digest(d), root); err != nil {
+			return err
+		}
+	}
+
+	d := digest.FromBytes(m.Data)
+	if err := root.MkdirAll(path.Dir(blobPath(d)), 0755); err != nil {
+		return err
+	}
+	if err := root.WriteFile(blobPath(d), m.Data, 0644); err != nil {
+		return err
+	}
+
+	descriptor := oci.Descriptor{MediaType: m.MediaType, Digest: d, Size: int64(len(m.Data)), Platform: info.Platform}
+	if !strings.Contains(info.Ref, ":") {
+		descriptor.Annotations = map[string]string{oci.AnnotationRefName: info.Ref}
+	}
+	index := oci.Index{
+		Versioned: oci.Versioned{SchemaVersion: 2},
+		MediaType: oci.MediaTypeImageIndex,
+		Manifests: []oci.Descriptor{descriptor},
+	}
+	data, err := index.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if err := root.WriteFile(oci.ImageIndexFile, data, 0644); err != nil {
+		return err
+	}
+
+	layout := oci.ImageLayout{Version: oci.ImageLayoutVersion}
+	if data, err = layout.MarshalJSON(); err != nil {
+		return err
+	}
+	return root.WriteFile(oci.ImageLayoutFile, data, 0644)
+}
+
+// exportImage extracts the root filesystem of the image or writes it as an OCI image layout with --oci-layout
+func exportImage(ctx context.Context, image string, dir string) {
+	r, repo, info, err := imageLayers(ctx, image)
+	if err != nil {
+		log.Fatal(err)
+	}
+	root, err := openEmptyDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer root.Close()
+
+	if opts.ociLayout {
+		err = exportLayout(ctx, r, repo, info, root)
+	} else {
+		err = exportRootFS(ctx, r, repo, info, root)
+	}
+	if err != nil {
+		logError(ctx, "%s: %v\n", image, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+func Test_exportLayout(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	r := f.client(t)
+	ctx := context.Background()
+
+	pushImage(f, "repo", "1.0")
+	infos, err := r.GetInfoAll(ctx, "repo", "1.0", []string{"arm64"}, nil)
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("got %d infos: %v", len(infos), err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "layout")
+	root, err := openEmptyDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if err := exportLayout(ctx, r, "repo", infos[0], root); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, oci.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index oci.Index
+	if err := index.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest.String() != infos[0].Digest || index.Manifests[0].Annotations[oci.AnnotationRefName] != "1.0" {
+		t.Fatalf("got index %s", data)
+	}
+
+	// Every blob referenced by the manifest must be there with the right digest
+	m, err := os.ReadFile(filepath.Join(dir, blobPath(index.Manifests[0].Digest)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest oci.Manifest
+	if err := json.Unmarshal(m, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range append([]oci.Descriptor{manifest.Config}, manifest.Layers...) {
+		data, err := os.ReadFile(filepath.Join(dir, blobPath(d.Digest)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest.FromBytes(data) != d.Digest {
+			t.Errorf("%s: digest mismatch", d.Digest)
+		}
+	}
+
+	if layout, _ := os.ReadFile(filepath.Join(dir, oci.ImageLayoutFile)); string(layout) != `{"imageLayoutVersion":"1.0.0"}` {
+		t.Errorf("got oci-layout %s", layout)
+	}
+
+	if _, err := openEmptyDir(dir); err == nil {
+		t.Error("expected error for a directory that's not empty")
+	}
+}
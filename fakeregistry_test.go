@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ricardobranco777/regview/registry"
+
+	types "github.com/moby/moby/api/types/registry"
+	digest "github.com/opencontainers/go-digest"
+)
+
+var reFakePath = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs)/(.+)$`)
+
+// fakeRegistry is an in-memory registry without authentication
+type fakeRegistry struct {
+	*httptest.Server
+	mu         sync.Mutex
+	manifests  map[string][]byte // repo:ref & repo@digest
+	mediaTypes map[string]string
+	blobs      map[string][]byte // repo@digest
+	uploads    map[string][]byte
+	mounts     int
+	noMount    bool // Answer mounts with a new upload
+	puts       int  // Manifests PUT
+}
+
+func newFakeRegistry() *fakeRegistry {
+	f := &fakeRegistry{
+		manifests:  make(map[string][]byte),
+		mediaTypes: make(map[string]string),
+		blobs:      make(map[string][]byte),
+		uploads:    make(map[string][]byte),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeRegistry) client(t *testing.T) *registry.Registry {
+	r, err := registry.New(context.Background(), types.AuthConfig{ServerAddress: f.URL}, registry.Opt{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// putManifest stores the manifest under the tag, if any, & its digest
+func (f *fakeRegistry) putManifest(repo string, tag string, mediaType string, data []byte) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := digest.FromBytes(data).String()
+	for _, ref := range []string{tag, d} {
+		if ref == "" {
+			continue
+		}
+		f.manifests[repo+":"+ref] = data
+		f.mediaTypes[repo+":"+ref] = mediaType
+	}
+	return d
+}
+
+func (f *fakeRegistry) putBlob(repo string, data []byte) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := digest.FromBytes(data).String()
+	f.blobs[repo+"@"+d] = data
+	return d
+}
+
+func (f *fakeRegistry) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/v2/_catalog" {
+		f.catalog(w)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/tags/list") {
+		f.tags(w, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/tags/list"))
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/blobs/uploads/") {
+		f.startUpload(w, r)
+		return
+	}
+	if strings.Contains(r.URL.Path, "/blobs/uploads/") {
+		f.upload(w, r)
+		return
+	}
+
+	m := reFakePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	repo, kind, ref := m[1], m[2], m[3]
+
+	if kind == "blobs" {
+		data, ok := f.blobs[repo+"@"+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":"BLOB_UNKNOWN"}]}`))
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", ref)
+		w.Write(data)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.manifests[repo+":"+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`))
+			return
+		}
+		w.Header().Set("Content-Type", f.mediaTypes[repo+":"+ref])
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		w.Write(data)
+	case http.MethodPut:
+		f.puts++
+		data, _ := io.ReadAll(r.Body)
+		d := digest.FromBytes(data).String()
+		for _, ref := range []string{ref, d} {
+			f.manifests[repo+":"+ref] = data
+			f.mediaTypes[repo+":"+ref] = r.Header.Get("Content-Type")
+		}
+		w.Header().Set("Docker-Content-Digest", d)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		delete(f.manifests, repo+":"+ref)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// tagList returns the tags in the repositories
+func (f *fakeRegistry) tagList() map[string][]string {
+	tags := make(map[string][]string)
+	for key := range f.manifests {
+		repo, ref, _ := strings.Cut(key, ":")
+		if !strings.HasPrefix(ref, "sha256:") {
+			tags[repo] = append(tags[repo], ref)
+		}
+	}
+	return tags
+}
+
+func (f *fakeRegistry) catalog(w http.ResponseWriter) {
+	var repos []string
+	for repo := range f.tagList() {
+		repos = append(repos, repo)
+	}
+	json.NewEncoder(w).Encode(map[string][]string{"repositories": repos})
+}
+
+func (f *fakeRegistry) tags(w http.ResponseWriter, repo string) {
+	json.NewEncoder(w).Encode(map[string]any{"name": repo, "tags": f.tagList()[repo]})
+}
+
+func (f *fakeRegistry) startUpload(w http.ResponseWriter, r *http.Request) {
+	repo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/blobs/uploads/")
+	if from := r.URL.Query().Get("from"); from != "" && !f.noMount {
+		d := r.URL.Query().Get("mount")
+		if data, ok := f.blobs[from+"@"+d]; ok {
+			f.blobs[repo+"@"+d] = data
+			f.mounts++
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+	}
+	id := fmt.Sprintf("%d", len(f.uploads))
+	f.uploads[id] = nil
+	w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *fakeRegistry) upload(w http.ResponseWriter, r *http.Request) {
+	repo, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/blobs/uploads/")
+	data, _ := io.ReadAll(r.Body)
+	f.uploads[id] = append(f.uploads[id], data...)
+	switch r.Method {
+	case http.MethodPatch:
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		d := r.URL.Query().Get("digest")
+		if digest.FromBytes(f.uploads[id]).String() != d {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"code":"DIGEST_INVALID"}]}`))
+			return
+		}
+		f.blobs[repo+"@"+d] = f.uploads[id]
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
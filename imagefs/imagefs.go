@@ -0,0 +1,291 @@
+// Package imagefs builds the merged filesystem view of the layers of an image
+// https://github.com/opencontainers/image-spec/blob/main/layer.md
+package imagefs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+	maxSymlinks    = 255
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Entry is a file in the merged filesystem
+type Entry struct {
+	*tar.Header
+	Path  string // Cleaned absolute path
+	Layer int    // Index of the layer with this version of the file
+}
+
+// FS is the merged filesystem of the layers applied so far
+type FS struct {
+	entries  map[string]*Entry
+	children map[string]map[string]bool // Names in each directory. Built on demand
+	layers   int
+}
+
+// New returns an empty filesystem
+func New() *FS {
+	return &FS{entries: map[string]*Entry{"/": {Header: &tar.Header{Typeflag: tar.TypeDir, Mode: 0755}, Path: "/", Layer: -1}}}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
+
+// Decompress detects the gzip or zstd compression of the layer returning a reader for the tar stream
+func Decompress(rd io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(rd)
+	magic, _ := br.Peek(len(magicZstd))
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, magicZstd):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: zr, close: func() error { zr.Close(); return nil }}, nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// clean returns the absolute path of a tar entry
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// remove removes the entries under the directory from previous layers & the directory itself unless onlyChildren is true
+func (f *FS) remove(dir string, onlyChildren bool) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for p, e := range f.entries {
+		if e.Layer < f.layers && (strings.HasPrefix(p, prefix) || !onlyChildren && p == dir) {
+			delete(f.entries, p)
+		}
+	}
+}
+
+// AddLayer applies the uncompressed tar stream of the next layer
+func (f *FS) AddLayer(rd io.Reader) error {
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		p := clean(hdr.Name)
+		dir, base := path.Split(p)
+		dir = path.Clean(dir)
+		switch {
+		case base == whiteoutOpaque:
+			f.remove(dir, true)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			f.remove(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), false)
+		default:
+			if old, ok := f.entries[p]; ok && old.Typeflag == tar.TypeDir && hdr.Typeflag != tar.TypeDir {
+				// A file replacing a directory hides its contents
+				f.remove(p, true)
+			}
+			f.entries[p] = &Entry{Header: hdr, Path: p, Layer: f.layers}
+		}
+	}
+	f.layers++
+	f.children = nil
+	return nil
+}
+
+// index returns the names in each directory including the directories implied by the entries under them
+func (f *FS) index() map[string]map[string]bool {
+	if f.children != nil {
+		return f.children
+	}
+	f.children = make(map[string]map[string]bool)
+	for p := range f.entries {
+		for p != "/" {
+			dir, base := path.Split(p)
+			dir = path.Clean(dir)
+			if f.children[dir] == nil {
+				f.children[dir] = make(map[string]bool)
+			}
+			if f.children[dir][base] {
+				break
+			}
+			f.children[dir][base] = true
+			p = dir
+		}
+	}
+	return f.children
+}
+
+// resolve follows the symbolic links in the path & in the last component if follow is true
+func (f *FS) resolve(p string, follow bool) (string, error) {
+	p = clean(p)
+	for hops := 0; hops < maxSymlinks; hops++ {
+		components := strings.Split(strings.TrimPrefix(p, "/"), "/")
+		resolved := "/"
+		linked := false
+		for i, c := range components {
+			next := path.Join(resolved, c)
+			e, ok := f.entries[next]
+			if ok && e.Typeflag == tar.TypeSymlink && (follow || i < len(components)-1) {
+				target := e.Linkname
+				if !path.IsAbs(target) {
+					target = path.Join(resolved, target)
+				}
+				p = path.Join(append([]string{clean(target)}, components[i+1:]...)...)
+				linked = true
+				break
+			}
+			resolved = next
+		}
+		if !linked {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+}
+
+// isDir returns true for directories including those implied by the entries under them
+func (f *FS) isDir(p string) bool {
+	if e, ok := f.entries[p]; ok {
+		return e.Typeflag == tar.TypeDir
+	}
+	return f.index()[p] != nil
+}
+
+// Lstat returns the entry for the path without following a symbolic link in the last component.
+// Directories without entries in the layers are synthesized
+func (f *FS) Lstat(name string) (*Entry, error) {
+	return f.stat(name, false)
+}
+
+// Stat returns the entry for the path following symbolic links
+func (f *FS) Stat(name string) (*Entry, error) {
+	return f.stat(name, true)
+}
+
+func (f *FS) stat(name string, follow bool) (*Entry, error) {
+	p, err := f.resolve(name, follow)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := f.entries[p]; ok {
+		return e, nil
+	}
+	if f.isDir(p) {
+		return &Entry{Header: &tar.Header{Name: p, Typeflag: tar.TypeDir, Mode: 0755}, Path: p, Layer: -1}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the entries in the directory sorted by name
+func (f *FS) ReadDir(name string) ([]*Entry, error) {
+	e, err := f.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if e.Typeflag != tar.TypeDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	var entries []*Entry
+	for child := range f.index()[e.Path] {
+		if e, err := f.Lstat(path.Join(e.Path, child)); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// Walk calls fn for the entry and every entry under it sorted by path.  Symbolic links are not followed
+func (f *FS) Walk(name string, fn func(e *Entry) error) error {
+	e, err := f.Stat(name)
+	if err != nil {
+		return err
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+	if e.Typeflag != tar.TypeDir {
+		return nil
+	}
+	entries, err := f.ReadDir(e.Path)
+	if err != nil {
+		return err
+	}
+	for _, child := range entries {
+		if child.Typeflag == tar.TypeDir {
+			err = f.Walk(child.Path, fn)
+		} else {
+			err = fn(child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open returns the entry with the contents of the file following symbolic & hard links
+func (f *FS) Open(name string) (*Entry, error) {
+	e, err := f.Stat(name)
+	for hops := 0; err == nil && e.Typeflag == tar.TypeLink; hops++ {
+		if hops == maxSymlinks {
+			return nil, fmt.Errorf("%s: too many links", name)
+		}
+		e, err = f.Stat(e.Linkname)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Typeflag != tar.TypeReg {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("not a regular file")}
+	}
+	return e, nil
+}
+
+// Extract copies the contents of the entry from the uncompressed tar stream of its layer
+func Extract(rd io.Reader, e *Entry, w io.Writer) error {
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return &fs.PathError{Op: "extract", Path: e.Path, Err: fs.ErrNotExist}
+		}
+		if err != nil {
+			return err
+		}
+		if clean(hdr.Name) == e.Path {
+			_, err = io.Copy(w, tr)
+			return err
+		}
+	}
+}
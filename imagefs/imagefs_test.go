@@ -0,0 +1,180 @@
+package imagefs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type file struct {
+	name     string
+	typeflag byte
+	data     string // Contents or link target
+}
+
+func makeLayer(t *testing.T, files ...file) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Typeflag: f.typeflag, Mode: 0644}
+		switch f.typeflag {
+		case tar.TypeReg:
+			hdr.Size = int64(len(f.data))
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		case tar.TypeSymlink, tar.TypeLink:
+			hdr.Linkname = f.data
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if f.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(f.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	layer := makeLayer(t, file{"etc/hostname", tar.TypeReg, "localhost\n"})
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(layer)
+	gw.Close()
+
+	var zst bytes.Buffer
+	zw, _ := zstd.NewWriter(&zst)
+	zw.Write(layer)
+	zw.Close()
+
+	for name, data := range map[string][]byte{"uncompressed": layer, "gzip": gz.Bytes(), "zstd": zst.Bytes()} {
+		rd, err := Decompress(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := io.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, layer) {
+			t.Errorf("%s: got different contents", name)
+		}
+	}
+}
+
+func names(entries []*Entry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Path)
+	}
+	return names
+}
+
+func TestFS(t *testing.T) {
+	layers := [][]byte{
+		makeLayer(t,
+			file{"etc/", tar.TypeDir, ""},
+			file{"etc/os-release", tar.TypeReg, "ID=alpine\n"},
+			file{"etc/passwd", tar.TypeReg, "root:x:0:0\n"},
+			file{"usr/lib/libc.so", tar.TypeReg, "libc"},
+			file{"var/cache/a", tar.TypeReg, "a"},
+			file{"var/cache/b", tar.TypeReg, "b"},
+			file{"lib", tar.TypeSymlink, "usr/lib"},
+		),
+		makeLayer(t,
+			file{"etc/.wh.passwd", tar.TypeReg, ""},
+			file{"var/cache/.wh..wh..opq", tar.TypeReg, ""},
+			file{"var/cache/c", tar.TypeReg, "c"},
+			file{"etc/os-release", tar.TypeReg, "ID=debian\n"},
+			file{"etc/release", tar.TypeLink, "etc/os-release"},
+		),
+	}
+
+	f := New()
+	for _, layer := range layers {
+		if err := f.AddLayer(bytes.NewReader(layer)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{"/", []string{"/etc", "/lib", "/usr", "/var"}},
+		{"/etc", []string{"/etc/os-release", "/etc/release"}},
+		{"/var/cache", []string{"/var/cache/c"}},
+		{"/lib", []string{"/usr/lib/libc.so"}},
+	}
+	for _, test := range tests {
+		entries, err := f.ReadDir(test.dir)
+		if err != nil {
+			t.Fatalf("%s: %v", test.dir, err)
+		}
+		if got := names(entries); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ReadDir(%s) = %q; want %q", test.dir, got, test.want)
+		}
+	}
+
+	if _, err := f.Stat("/etc/passwd"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("whiteout file still exists: %v", err)
+	}
+	if e, err := f.Lstat("/lib"); err != nil || e.Typeflag != tar.TypeSymlink {
+		t.Errorf("Lstat(/lib) = %v, %v", e, err)
+	}
+
+	var walked []string
+	if err := f.Walk("/var", func(e *Entry) error {
+		walked = append(walked, e.Path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/var", "/var/cache", "/var/cache/c"}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk(/var) = %q; want %q", walked, want)
+	}
+
+	for _, name := range []string{"/etc/os-release", "/etc/release", "/lib/libc.so"} {
+		e, err := f.Open(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := Extract(bytes.NewReader(layers[e.Layer]), e, &buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := map[string]string{"/etc/os-release": "ID=debian\n", "/etc/release": "ID=debian\n", "/lib/libc.so": "libc"}[name]
+		if buf.String() != want {
+			t.Errorf("%s: got %q; want %q", name, buf.String(), want)
+		}
+	}
+
+	if _, err := f.Open("/etc"); err == nil {
+		t.Error("expected error opening a directory")
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	f := New()
+	layer := makeLayer(t, file{"a", tar.TypeSymlink, "b"}, file{"b", tar.TypeSymlink, "/a"})
+	if err := f.AddLayer(bytes.NewReader(layer)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat("/a/x"); err == nil {
+		t.Error("expected error for symlink loop")
+	}
+}
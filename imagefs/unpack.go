@@ -0,0 +1,217 @@
+package imagefs
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Unpacker applies layers to a directory.  Devices & FIFOs are skipped as they need privileges
+type Unpacker struct {
+	root  *os.Root
+	chown bool
+	dirs  map[string]*tar.Header // Mode & times of directories are set in Close so they remain writable
+	layer map[string]bool        // Paths in the current layer
+}
+
+// NewUnpacker returns an Unpacker for the directory.  Owners are kept only if chown is true
+func NewUnpacker(root *os.Root, chown bool) *Unpacker {
+	return &Unpacker{root: root, chown: chown, dirs: make(map[string]*tar.Header)}
+}
+
+// rel returns the path of a tar entry relative to the root
+func rel(name string) string {
+	if p := strings.TrimPrefix(clean(name), "/"); p != "" {
+		return p
+	}
+	return "."
+}
+
+// mode returns the permission bits of the entry
+func mode(hdr *tar.Header) fs.FileMode {
+	return hdr.FileInfo().Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+}
+
+// resolve follows the symbolic links in the parent directories of the path relative to the root.
+// Absolute links like var/run -> /run are resolved against the root as in a container
+func (u *Unpacker) resolve(p string) (string, error) {
+	for hops := 0; hops < maxSymlinks; hops++ {
+		components := strings.Split(p, "/")
+		resolved := "."
+		linked := false
+		for i, c := range components[:len(components)-1] {
+			next := path.Join(resolved, c)
+			if fi, err := u.root.Lstat(next); err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+				resolved = next
+				continue
+			}
+			target, err := u.root.Readlink(next)
+			if err != nil {
+				return "", err
+			}
+			if !path.IsAbs(target) {
+				target = path.Join("/", resolved, target)
+			}
+			p = rel(path.Join(append([]string{target}, components[i+1:]...)...))
+			linked = true
+			break
+		}
+		if !linked {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+}
+
+// removeAll removes the path forgetting about the directories under it
+func (u *Unpacker) removeAll(p string) error {
+	for dir := range u.dirs {
+		if dir == p || strings.HasPrefix(dir, p+"/") {
+			delete(u.dirs, dir)
+		}
+	}
+	return u.root.RemoveAll(p)
+}
+
+// opaque removes the contents of the directory from previous layers
+func (u *Unpacker) opaque(dir string) error {
+	f, err := u.root.Open(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	entries, err := f.ReadDir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if p := path.Join(dir, e.Name()); !u.layer[p] {
+			if err := u.removeAll(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// create creates the file, directory or link replacing what's there from previous layers
+func (u *Unpacker) create(hdr *tar.Header, p string, rd io.Reader) error {
+	if p == "." {
+		return nil
+	}
+	if err := u.root.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	fi, err := u.root.Lstat(p)
+	if err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		if err := u.removeAll(p); err != nil {
+			return err
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if fi == nil || !fi.IsDir() {
+			if err := u.root.Mkdir(p, 0755); err != nil {
+				return err
+			}
+		}
+		u.dirs[p] = hdr
+		return nil
+	case tar.TypeReg:
+		f, err := u.root.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, rd)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		return u.chownLink(p, hdr, u.root.Symlink(hdr.Linkname, p))
+	case tar.TypeLink:
+		target, err := u.resolve(rel(hdr.Linkname))
+		if err != nil {
+			return err
+		}
+		return u.root.Link(target, p)
+	default:
+		return nil
+	}
+
+	if err := u.chownLink(p, hdr, u.root.Chmod(p, mode(hdr))); err != nil {
+		return err
+	}
+	return u.root.Chtimes(p, hdr.AccessTime, hdr.ModTime)
+}
+
+// chownLink sets the owner of the path if there was no error & owners are kept
+func (u *Unpacker) chownLink(p string, hdr *tar.Header, err error) error {
+	if err != nil || !u.chown {
+		return err
+	}
+	return u.root.Lchown(p, hdr.Uid, hdr.Gid)
+}
+
+// AddLayer applies the uncompressed tar stream of the next layer
+func (u *Unpacker) AddLayer(rd io.Reader) error {
+	u.layer = make(map[string]bool)
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, err := u.resolve(rel(hdr.Name))
+		if err != nil {
+			return err
+		}
+		dir, base := path.Split(p)
+		dir = path.Clean(dir)
+		switch {
+		case base == whiteoutOpaque:
+			err = u.opaque(dir)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			err = u.removeAll(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+		default:
+			u.layer[p] = true
+			err = u.create(hdr, p, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close sets the mode & times of the directories, the deepest first
+func (u *Unpacker) Close() error {
+	var dirs []string
+	for dir := range u.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		hdr := u.dirs[dir]
+		if err := u.chownLink(dir, hdr, u.root.Chmod(dir, mode(hdr))); err != nil {
+			return err
+		}
+		if err := u.root.Chtimes(dir, hdr.AccessTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package imagefs
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestUnpacker(t *testing.T) {
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	layers := [][]byte{
+		makeLayer(t,
+			file{"etc/", tar.TypeDir, ""},
+			file{"etc/os-release", tar.TypeReg, "ID=alpine\n"},
+			file{"etc/passwd", tar.TypeReg, "root:x:0:0\n"},
+			file{"var/cache/a", tar.TypeReg, "a"},
+			file{"private/", tar.TypeDir, ""},
+			file{"lib", tar.TypeSymlink, "usr/lib"},
+		),
+		makeLayer(t,
+			file{"var/cache/.wh..wh..opq", tar.TypeReg, ""},
+			file{"var/cache/b", tar.TypeReg, "b"},
+			file{"etc/.wh.passwd", tar.TypeReg, ""},
+			file{"etc/os-release", tar.TypeReg, "ID=debian\n"},
+			file{"etc/release", tar.TypeLink, "/etc/os-release"},
+			file{"../../escape", tar.TypeReg, "x"},
+		),
+	}
+
+	u := NewUnpacker(root, false)
+	for _, layer := range layers {
+		if err := u.AddLayer(bytes.NewReader(layer)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Make a directory private to check modes are set at the end
+	u.dirs["private"].Mode = 0700
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files = append(files, rel)
+		return nil
+	})
+	sort.Strings(files)
+	want := []string{".", "escape", "etc", "etc/os-release", "etc/release", "lib", "private", "var", "var/cache", "var/cache/b"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %q; want %q", files, want)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "etc/release")); string(data) != "ID=debian\n" {
+		t.Errorf("etc/release: got %q", data)
+	}
+	if target, _ := os.Readlink(filepath.Join(dir, "lib")); target != "usr/lib" {
+		t.Errorf("lib: got %q", target)
+	}
+	if fi, _ := os.Stat(filepath.Join(dir, "etc/os-release")); fi.Mode().Perm() != 0644 {
+		t.Errorf("etc/os-release: got mode %v", fi.Mode())
+	}
+	if fi, _ := os.Stat(filepath.Join(dir, "private")); fi.Mode().Perm() != 0700 {
+		t.Errorf("private: got mode %v", fi.Mode())
+	}
+}
+
+func TestUnpackerParentSymlink(t *testing.T) {
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	// Debian & Ubuntu have var/run -> /run and var/lock -> /run/lock
+	layers := [][]byte{
+		makeLayer(t,
+			file{"run/", tar.TypeDir, ""},
+			file{"run/lock/", tar.TypeDir, ""},
+			file{"var/run", tar.TypeSymlink, "/run"},
+			file{"var/lock", tar.TypeSymlink, "../run/lock"},
+		),
+		makeLayer(t,
+			file{"var/run/foo", tar.TypeReg, "foo"},
+			file{"var/lock/bar", tar.TypeReg, "bar"},
+			file{"var/run/baz", tar.TypeLink, "/var/lock/bar"},
+		),
+	}
+
+	u := NewUnpacker(root, false)
+	for _, layer := range layers {
+		if err := u.AddLayer(bytes.NewReader(layer)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"run/foo": "foo", "run/lock/bar": "bar", "run/baz": "bar"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if target, _ := os.Readlink(filepath.Join(dir, "var/run")); target != "/run" {
+		t.Errorf("var/run: got %q", target)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ricardobranco777/regview/registry"
+)
+
+// journalEntry holds what's needed to restore a deleted manifest
+type journalEntry struct {
+	Time       time.Time `json:"time"`
+	Registry   string    `json:"registry"`
+	Repository string    `json:"repository"`
+	Digest     string    `json:"digest"`
+	MediaType  string    `json:"media_type"`
+	Manifest   []byte    `json:"manifest"`
+	Index      string    `json:"index,omitempty"` // Digest of the index containing the manifest
+	Tags       []string  `json:"tags,omitempty"`  // Tags pointing to the manifest
+}
+
+// journal is an NDJSON file with an entry per deleted manifest.
+// Entries are synced to disk before deleting anything.
+type journal struct {
+	sync.Mutex
+	path string
+	file *os.File
+}
+
+var deleted journal
+
+// stateDir returns $XDG_STATE_HOME/regview or ~/.local/state/regview
+func stateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "regview")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "regview")
+	}
+	return ""
+}
+
+func (j *journal) write(entry *journalEntry) error {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.file == nil {
+		if err := os.MkdirAll(opts.journal, 0700); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%s.journal", time.Now().Format("20060102-150405"), strings.ReplaceAll(entry.Registry, ":", "_"))
+		j.path = filepath.Join(opts.journal, name)
+		f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		j.file = f
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Close closes the journal printing how to restore it
+func (j *journal) Close() {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.file == nil {
+		return
+	}
+	if err := j.file.Close(); err != nil {
+		log.Print(err)
+	}
+	fmt.Fprintf(os.Stderr, "Deleted manifests saved in %s. Use --restore to restore them\n", j.path)
+}
+
+// backup saves the manifest to the journal before deleting it unless the journal is disabled.
+// It returns false if there's nothing to delete.
+func backup(ctx context.Context, r *registry.Registry, repo string, ref string, index string, tags []string) (bool, error) {
+	if opts.journal == "" {
+		return true, nil
+	}
+	m, err := r.GetManifest(ctx, repo, ref)
+	if err != nil {
+		if err.Error() == "MANIFEST_UNKNOWN" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, deleted.write(&journalEntry{
+		Time:       time.Now(),
+		Registry:   r.Domain,
+		Repository: repo,
+		Digest:     m.Digest,
+		MediaType:  m.MediaType,
+		Manifest:   m.Data,
+		Index:      index,
+		Tags:       tags,
+	})
+}
+
+func readJournal(path string) ([]*journalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, scanner.Err()
+}
+
+// restoreOrder sorts manifests before the indexes that reference them
+func restoreOrder(entries []*journalEntry) {
+	slices.SortStableFunc(entries, func(a, b *journalEntry) int {
+		isIndex := func(e *journalEntry) bool {
+			return (&registry.Manifest{MediaType: e.MediaType}).IsIndex()
+		}
+		switch {
+		case !isIndex(a) && isIndex(b):
+			return -1
+		case isIndex(a) && !isIndex(b):
+			return 1
+		}
+		return 0
+	})
+}
+
+// restoreJournal puts back the manifests & tags in the journal
+func restoreJournal(ctx context.Context, path string) {
+	entries, err := readJournal(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	restoreOrder(entries)
+
+	clients := make(map[string]*registry.Registry)
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		r, ok := clients[entry.Registry]
+		if !ok {
+			if r, err = createRegistryClient(ctx, entry.Registry); err != nil {
+				log.Fatal(err)
+			}
+			clients[entry.Registry] = r
+		}
+
+		for _, ref := range append([]string{entry.Digest}, entry.Tags...) {
+			sep := ":"
+			if ref == entry.Digest {
+				sep = "@"
+			}
+			fmt.Printf("Restoring %s%s%s\n", entry.Repository, sep, ref)
+			if opts.dryRun {
+				continue
+			}
+			if _, err := r.PutManifest(ctx, entry.Repository, ref, entry.MediaType, entry.Manifest); err != nil {
+				logError(ctx, "%s%s%s: %v\n", entry.Repository, sep, ref, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+)
+
+func Test_journal(t *testing.T) {
+	defer func(dir string) { opts.journal = dir }(opts.journal)
+	opts.journal = t.TempDir()
+
+	var j journal
+	entries := []*journalEntry{
+		{Registry: "localhost:5000", Repository: "repo", Digest: "sha256:index", MediaType: oci.MediaTypeImageIndex, Manifest: []byte(`{"manifests":[]}`), Tags: []string{"latest", "stable"}},
+		{Registry: "localhost:5000", Repository: "repo", Digest: "sha256:amd64", MediaType: oci.MediaTypeImageManifest, Manifest: []byte(`{"layers":[]}`), Index: "sha256:index"},
+	}
+	for _, entry := range entries {
+		if err := j.write(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.file.Close()
+
+	got, err := readJournal(j.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("got %+v; want %+v", got, entries)
+	}
+
+	restoreOrder(got)
+	if got[0].Digest != "sha256:amd64" || got[1].Digest != "sha256:index" {
+		t.Errorf("manifests must be restored before indexes: got %s, %s", got[0].Digest, got[1].Digest)
+	}
+}
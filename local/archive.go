@@ -0,0 +1,185 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// archiveManifestFile lists the images in the archive
+const archiveManifestFile = "manifest.json"
+
+// archiveImage is an entry in manifest.json
+type archiveImage struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Archive is a tar archive created by docker save.
+// As it has no manifests they're synthesized from the configs & the layers, which are uncompressed
+type Archive struct {
+	store     store
+	blobs     map[string]string                        // Digest -> file
+	manifests map[string]*registry.Manifest            // Digest -> synthesized manifest
+	tags      map[string]map[string]*registry.Manifest // Repository -> tag -> manifest
+}
+
+var _ registry.Backend = (*Archive)(nil)
+
+// openArchive reads manifest.json & the configs in the archive
+func openArchive(file string) (*Archive, error) {
+	s, err := openTar(file)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{
+		store:     s,
+		blobs:     make(map[string]string),
+		manifests: make(map[string]*registry.Manifest),
+		tags:      make(map[string]map[string]*registry.Manifest),
+	}
+	if err := a.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return a, nil
+}
+
+// splitRepoTag splits REPOSITORY[:TAG]
+func splitRepoTag(s string) (string, string) {
+	if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		return s[:i], s[i+1:]
+	}
+	return s, "latest"
+}
+
+func (a *Archive) load() error {
+	data, err := readFile(a.store, archiveManifestFile)
+	if err != nil {
+		return fmt.Errorf("not a docker archive: %v", err)
+	}
+	var images []archiveImage
+	if err := json.Unmarshal(data, &images); err != nil {
+		return fmt.Errorf("%s: %v", archiveManifestFile, err)
+	}
+	for _, image := range images {
+		m, err := a.addImage(image)
+		if err != nil {
+			return err
+		}
+		for _, repoTag := range image.RepoTags {
+			repo, tag := splitRepoTag(repoTag)
+			if a.tags[repo] == nil {
+				a.tags[repo] = make(map[string]*registry.Manifest)
+			}
+			a.tags[repo][tag] = m
+		}
+	}
+	return nil
+}
+
+// addImage synthesizes the manifest of the image.  The digests of uncompressed layers are the diff IDs in the config
+func (a *Archive) addImage(image archiveImage) (*registry.Manifest, error) {
+	data, err := readFile(a.store, image.Config)
+	if err != nil {
+		return nil, err
+	}
+	var config oci.Image
+	if err := config.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("%s: %v", image.Config, err)
+	}
+	if len(config.RootFS.DiffIDs) != len(image.Layers) {
+		return nil, fmt.Errorf("%s: %d diff IDs for %d layers", image.Config, len(config.RootFS.DiffIDs), len(image.Layers))
+	}
+
+	manifest := oci.Manifest{
+		Versioned: oci.Versioned{SchemaVersion: 2},
+		MediaType: oci.MediaTypeImageManifest,
+		Config:    oci.Descriptor{MediaType: oci.MediaTypeImageConfig, Digest: digest.FromBytes(data), Size: int64(len(data))},
+		Layers:    []oci.Descriptor{},
+	}
+	a.blobs[manifest.Config.Digest.String()] = image.Config
+	for i, layer := range image.Layers {
+		size, err := a.store.size(layer)
+		if err != nil {
+			return nil, err
+		}
+		d := config.RootFS.DiffIDs[i]
+		manifest.Layers = append(manifest.Layers, oci.Descriptor{MediaType: oci.MediaTypeImageLayer, Digest: d, Size: size})
+		a.blobs[d.String()] = layer
+	}
+
+	if data, err = manifest.MarshalJSON(); err != nil {
+		return nil, err
+	}
+	m := &registry.Manifest{MediaType: oci.MediaTypeImageManifest, Digest: digest.FromBytes(data).String(), Data: data}
+	a.manifests[m.Digest] = m
+	return m, nil
+}
+
+// Close closes the archive
+func (a *Archive) Close() error {
+	return a.store.Close()
+}
+
+// Catalog returns the repositories of the tagged images
+func (a *Archive) Catalog(ctx context.Context, u string) ([]string, error) {
+	var repos []string
+	for repo := range a.tags {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// Tags returns the tags in the repository
+func (a *Archive) Tags(ctx context.Context, repo string) ([]string, error) {
+	if a.tags[repo] == nil {
+		return nil, errRepositoryUnknown
+	}
+	var tags []string
+	for tag := range a.tags[repo] {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// GetBlob returns a reader for the config or layer.  The caller must close it
+func (a *Archive) GetBlob(ctx context.Context, repo string, dgst string) (io.ReadCloser, error) {
+	file, ok := a.blobs[dgst]
+	if !ok {
+		return nil, errBlobUnknown
+	}
+	return a.store.open(file)
+}
+
+// GetManifest gets the synthesized manifest
+func (a *Archive) GetManifest(ctx context.Context, repo string, ref string) (*registry.Manifest, error) {
+	m, ok := a.manifests[ref]
+	if !ok {
+		m, ok = a.tags[repo][ref]
+	}
+	if !ok {
+		return nil, errManifestUnknown
+	}
+	return m, nil
+}
+
+// GetImage gets the image config
+func (a *Archive) GetImage(ctx context.Context, repo string, ref string) (*oci.Image, error) {
+	return getImage(ctx, a, repo, ref)
+}
+
+// GetInfoAll from the synthesized manifest
+func (a *Archive) GetInfoAll(ctx context.Context, repo string, ref string, arches []string, oses []string) ([]*registry.Info, error) {
+	return getInfoAll(ctx, a, repo, ref, arches, oses)
+}
@@ -0,0 +1,154 @@
+package local
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Layout is an OCI image layout in a directory or in a tar archive
+// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+type Layout struct {
+	name  string
+	store store
+	index oci.Index
+}
+
+var _ registry.Backend = (*Layout)(nil)
+
+// openLayout reads the index of the image layout
+func openLayout(file string) (*Layout, error) {
+	s, err := openStore(file)
+	if err != nil {
+		return nil, err
+	}
+	l := &Layout{name: repoName(file), store: s}
+	if err := l.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return l, nil
+}
+
+func (l *Layout) load() error {
+	data, err := readFile(l.store, oci.ImageLayoutFile)
+	if err != nil {
+		return fmt.Errorf("not an OCI image layout: %v", err)
+	}
+	var layout oci.ImageLayout
+	if err := layout.UnmarshalJSON(data); err != nil || layout.Version == "" {
+		return fmt.Errorf("invalid %s", oci.ImageLayoutFile)
+	}
+	if data, err = readFile(l.store, oci.ImageIndexFile); err != nil {
+		return err
+	}
+	return l.index.UnmarshalJSON(data)
+}
+
+// Close closes the directory or the archive
+func (l *Layout) Close() error {
+	return l.store.Close()
+}
+
+func (l *Layout) checkRepo(repo string) error {
+	if repo != l.name {
+		return errRepositoryUnknown
+	}
+	return nil
+}
+
+// resolve returns the descriptor in the index for the tag or digest
+func (l *Layout) resolve(ref string) (oci.Descriptor, error) {
+	if d, err := digest.Parse(ref); err == nil {
+		for _, m := range l.index.Manifests {
+			if m.Digest == d {
+				return m, nil
+			}
+		}
+		// Manifests in an index are only in the blobs
+		return oci.Descriptor{Digest: d}, nil
+	}
+	for _, m := range l.index.Manifests {
+		if m.Annotations[oci.AnnotationRefName] == ref {
+			return m, nil
+		}
+	}
+	return oci.Descriptor{}, errManifestUnknown
+}
+
+// Catalog returns the only repository in the layout
+func (l *Layout) Catalog(ctx context.Context, u string) ([]string, error) {
+	return []string{l.name}, nil
+}
+
+// Tags returns the reference names in the index
+func (l *Layout) Tags(ctx context.Context, repo string) ([]string, error) {
+	if err := l.checkRepo(repo); err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, m := range l.index.Manifests {
+		if tag := m.Annotations[oci.AnnotationRefName]; tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// GetBlob returns a reader for the blob.  The caller must close it
+func (l *Layout) GetBlob(ctx context.Context, repo string, dgst string) (io.ReadCloser, error) {
+	if err := l.checkRepo(repo); err != nil {
+		return nil, err
+	}
+	d, err := digest.Parse(dgst)
+	if err != nil {
+		return nil, err
+	}
+	return l.store.open(path.Join(oci.ImageBlobsDir, d.Algorithm().String(), d.Encoded()))
+}
+
+// GetManifest gets the raw index or manifest
+func (l *Layout) GetManifest(ctx context.Context, repo string, ref string) (*registry.Manifest, error) {
+	if err := l.checkRepo(repo); err != nil {
+		return nil, err
+	}
+	d, err := l.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.GetBlob(ctx, repo, d.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if d.Digest.Algorithm().FromBytes(data) != d.Digest {
+		return nil, fmt.Errorf("%s: digest mismatch", d.Digest)
+	}
+	return &registry.Manifest{
+		MediaType: cmp.Or(d.MediaType, mediaType(data)),
+		Digest:    d.Digest.String(),
+		Data:      data,
+	}, nil
+}
+
+// GetImage gets the image config
+func (l *Layout) GetImage(ctx context.Context, repo string, ref string) (*oci.Image, error) {
+	return getImage(ctx, l, repo, ref)
+}
+
+// GetInfoAll from the index and then each manifest
+func (l *Layout) GetInfoAll(ctx context.Context, repo string, ref string, arches []string, oses []string) ([]*registry.Info, error) {
+	return getInfoAll(ctx, l, repo, ref, arches, oses)
+}
@@ -0,0 +1,186 @@
+// Package local reads images from OCI image layouts & the archives created by docker save
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+)
+
+const (
+	transportOCI           = "oci:"
+	transportDockerArchive = "docker-archive:"
+)
+
+var (
+	errRepositoryUnknown = errors.New("repository unknown")
+	errManifestUnknown   = errors.New("manifest unknown")
+	errBlobUnknown       = errors.New("blob unknown")
+)
+
+// Store is a local image store
+type Store interface {
+	registry.Backend
+	Close() error
+}
+
+// IsLocal returns true for oci: & docker-archive: arguments
+func IsLocal(arg string) bool {
+	return strings.HasPrefix(arg, transportOCI) || strings.HasPrefix(arg, transportDockerArchive)
+}
+
+// Open opens the store in an oci:PATH[:TAG|@DIGEST] or docker-archive:PATH[:REPOSITORY[:TAG|@DIGEST]] argument.
+// It also returns the image as REPOSITORY[:TAG|@DIGEST], if any.
+// OCI image layouts have a single repository named after the directory or the archive
+func Open(arg string) (Store, string, error) {
+	if file, ok := strings.CutPrefix(arg, transportOCI); ok {
+		// The path may have colons so the reference is what follows the last one in the last element
+		var ref string
+		slash := strings.LastIndex(file, "/")
+		if i := strings.LastIndex(file, "@"); i > slash {
+			file, ref = file[:i], file[i:]
+		} else if i := strings.LastIndex(file, ":"); i > slash {
+			file, ref = file[:i], file[i:]
+		}
+		if file == "" {
+			return nil, "", fmt.Errorf("%s: missing path", arg)
+		}
+		l, err := openLayout(file)
+		if err != nil {
+			return nil, "", err
+		}
+		if ref != "" {
+			ref = l.name + ref
+		}
+		return l, ref, nil
+	}
+
+	file, ref, _ := strings.Cut(strings.TrimPrefix(arg, transportDockerArchive), ":")
+	if file == "" {
+		return nil, "", fmt.Errorf("%s: missing path", arg)
+	}
+	a, err := openArchive(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return a, ref, nil
+}
+
+// repoName returns the name of the repository of an OCI image layout
+func repoName(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	return strings.TrimSuffix(filepath.Base(file), ".tar")
+}
+
+// readFile reads the whole file from the store
+func readFile(s store, name string) ([]byte, error) {
+	rc, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// mediaType returns the media type in the document falling back to the one implied by its fields
+func mediaType(data []byte) string {
+	var doc struct {
+		MediaType string          `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.MediaType != "" {
+		return doc.MediaType
+	}
+	if doc.Manifests != nil {
+		return oci.MediaTypeImageIndex
+	}
+	return oci.MediaTypeImageManifest
+}
+
+// getImage gets the image config
+func getImage(ctx context.Context, b registry.Backend, repo string, ref string) (*oci.Image, error) {
+	rc, err := b.GetBlob(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	var image oci.Image
+	if err := image.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// manifestInfo returns the info from the image manifest
+func manifestInfo(m *registry.Manifest, repo string, ref string) (*registry.Info, error) {
+	if m.IsIndex() {
+		return nil, errors.New("nested indexes are not supported")
+	}
+	var manifest oci.Manifest
+	if err := manifest.UnmarshalJSON(m.Data); err != nil {
+		return nil, err
+	}
+	info, err := registry.NewInfo(&manifest, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	info.Digest = m.Digest
+	return info, nil
+}
+
+// getInfoAll returns the infos from the index and then each manifest like the registry client.
+// On partial failure it returns the infos for the manifests it could get along with the errors.
+func getInfoAll(ctx context.Context, b registry.Backend, repo string, ref string, arches []string, oses []string) ([]*registry.Info, error) {
+	m, err := b.GetManifest(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !m.IsIndex() {
+		info, err := manifestInfo(m, repo, ref)
+		if err != nil {
+			return nil, err
+		}
+		return []*registry.Info{info}, nil
+	}
+
+	var index oci.Index
+	if err := index.UnmarshalJSON(m.Data); err != nil {
+		return nil, err
+	}
+	attestations := registry.AttestationDigests(&index)
+
+	var infos []*registry.Info
+	var errs []error
+	for _, manifest := range index.Manifests {
+		if registry.SkipPlatform(manifest.Platform, arches, oses) {
+			continue
+		}
+		child, err := b.GetManifest(ctx, repo, manifest.Digest.String())
+		var info *registry.Info
+		if err == nil {
+			info, err = manifestInfo(child, repo, ref)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s@%s: %w", repo, manifest.Digest, err))
+			continue
+		}
+		info.Platform = manifest.Platform
+		info.DigestAll = m.Digest
+		info.Attestation = attestations[manifest.Digest.String()]
+		infos = append(infos, info)
+	}
+	return infos, errors.Join(errs...)
+}
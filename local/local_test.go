@@ -0,0 +1,247 @@
+package local
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// makeTar returns a tar archive with the files.  Values starting with "->" are symbolic links
+func makeTar(t *testing.T, files map[string]string) []byte {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		data := files[name]
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}
+		if target, ok := strings.CutPrefix(data, "->"); ok {
+			hdr = &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(data))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func blobName(data string) (string, digest.Digest) {
+	d := digest.FromString(data)
+	return filepath.Join(oci.ImageBlobsDir, "sha256", d.Encoded()), d
+}
+
+// makeLayout returns the files of an image layout with a 2-arch index tagged 1.0 & an untagged manifest
+func makeLayout(t *testing.T) (map[string]string, string) {
+	files := map[string]string{
+		oci.ImageLayoutFile: `{"imageLayoutVersion":"1.0.0"}`,
+	}
+	layer := string(makeTar(t, map[string]string{"etc/os-release": "ID=test\n"}))
+	layerName, layerDigest := blobName(layer)
+	files[layerName] = layer
+
+	var manifests []string
+	for _, arch := range []string{"amd64", "arm64"} {
+		config := fmt.Sprintf(`{"architecture":"%s","os":"linux","rootfs":{"type":"layers","diff_ids":["%s"]}}`, arch, layerDigest)
+		configName, configDigest := blobName(config)
+		files[configName] = config
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"mediaType":"%s","digest":"%s","size":%d},"layers":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+			oci.MediaTypeImageManifest, oci.MediaTypeImageConfig, configDigest, len(config), oci.MediaTypeImageLayer, layerDigest, len(layer))
+		manifestName, manifestDigest := blobName(manifest)
+		files[manifestName] = manifest
+		manifests = append(manifests, fmt.Sprintf(`{"mediaType":"%s","digest":"%s","size":%d,"platform":{"architecture":"%s","os":"linux"}}`, oci.MediaTypeImageManifest, manifestDigest, len(manifest), arch))
+	}
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[%s,%s]}`, oci.MediaTypeImageIndex, manifests[0], manifests[1])
+	indexName, indexDigest := blobName(index)
+	files[indexName] = index
+
+	files[oci.ImageIndexFile] = fmt.Sprintf(`{"schemaVersion":2,"manifests":[{"mediaType":"%s","digest":"%s","size":%d,"annotations":{"%s":"1.0"}},%s]}`,
+		oci.MediaTypeImageIndex, indexDigest, len(index), oci.AnnotationRefName, manifests[1])
+	return files, indexDigest.String()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	ctx := context.Background()
+	files, indexDigest := makeLayout(t)
+
+	dir := filepath.Join(t.TempDir(), "layout")
+	writeFiles(t, dir, files)
+	archive := filepath.Join(t.TempDir(), "archive.tar")
+	if err := os.WriteFile(archive, makeTar(t, files), 0644); err != nil {
+		t.Fatal(err)
+	}
+	colon := filepath.Join(t.TempDir(), "c:", "colon")
+	writeFiles(t, colon, files)
+
+	for _, test := range []struct {
+		arg, name string
+	}{
+		{"oci:" + dir + ":1.0", "layout"},
+		{"oci:" + archive + ":1.0", "archive"},
+		{"oci:" + colon + ":1.0", "colon"},
+	} {
+		s, image, err := Open(test.arg)
+		if err != nil {
+			t.Fatalf("%s: %v", test.arg, err)
+		}
+		defer s.Close()
+		if image != test.name+":1.0" {
+			t.Errorf("%s: got image %q", test.arg, image)
+		}
+
+		repos, _ := s.Catalog(ctx, "")
+		if !reflect.DeepEqual(repos, []string{test.name}) {
+			t.Errorf("%s: got repositories %v", test.arg, repos)
+		}
+		tags, _ := s.Tags(ctx, test.name)
+		if !reflect.DeepEqual(tags, []string{"1.0"}) {
+			t.Errorf("%s: got tags %v", test.arg, tags)
+		}
+
+		infos, err := s.GetInfoAll(ctx, test.name, "1.0", []string{"arm64"}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.arg, err)
+		}
+		if len(infos) != 1 || infos[0].Platform.Architecture != "arm64" || infos[0].DigestAll != indexDigest || infos[0].Ref != "1.0" {
+			t.Fatalf("%s: got %+v", test.arg, infos)
+		}
+		image2, err := s.GetImage(ctx, test.name, infos[0].ID)
+		if err != nil || image2.Architecture != "arm64" {
+			t.Errorf("%s: got %+v, %v", test.arg, image2, err)
+		}
+
+		// The untagged manifest is available by digest
+		all, err := s.GetInfoAll(ctx, test.name, infos[0].Digest, nil, nil)
+		if err != nil || len(all) != 1 || all[0].Digest != infos[0].Digest {
+			t.Errorf("%s: got %+v, %v", test.arg, all, err)
+		}
+
+		rc, err := s.GetBlob(ctx, test.name, infos[0].Layers[0].Digest.String())
+		if err != nil {
+			t.Fatalf("%s: %v", test.arg, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if digest.FromBytes(data) != infos[0].Layers[0].Digest {
+			t.Errorf("%s: got different layer", test.arg)
+		}
+
+		if _, err := s.GetInfoAll(ctx, test.name, "2.0", nil, nil); err != errManifestUnknown {
+			t.Errorf("%s: got %v; want %v", test.arg, err, errManifestUnknown)
+		}
+	}
+
+	s, image, err := Open("oci:" + colon + "@" + indexDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if image != "colon@"+indexDigest {
+		t.Errorf("got image %q", image)
+	}
+
+	if _, _, err := Open("oci:" + t.TempDir()); err == nil {
+		t.Error("expected error for directory without an image layout")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+
+	layer := string(makeTar(t, map[string]string{"etc/os-release": "ID=test\n"}))
+	diffID := digest.FromString(layer)
+	config := fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":["%s","%s"]}}`, diffID, diffID)
+	configDigest := digest.FromString(config)
+
+	// Legacy archives link duplicate layers
+	file := filepath.Join(t.TempDir(), "image.tar")
+	data := makeTar(t, map[string]string{
+		"manifest.json":                  fmt.Sprintf(`[{"Config":"%s.json","RepoTags":["example.com/repo:1.0","repo"],"Layers":["a/layer.tar","b/layer.tar"]}]`, configDigest.Encoded()),
+		configDigest.Encoded() + ".json": config,
+		"a/layer.tar":                    layer,
+		"b/layer.tar":                    "->../a/layer.tar",
+	})
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, image, err := Open("docker-archive:" + file + ":example.com/repo:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if image != "example.com/repo:1.0" {
+		t.Errorf("got image %q", image)
+	}
+
+	repos, _ := s.Catalog(ctx, "")
+	if !reflect.DeepEqual(repos, []string{"example.com/repo", "repo"}) {
+		t.Errorf("got repositories %v", repos)
+	}
+	tags, _ := s.Tags(ctx, "repo")
+	if !reflect.DeepEqual(tags, []string{"latest"}) {
+		t.Errorf("got tags %v", tags)
+	}
+
+	infos, err := s.GetInfoAll(ctx, "example.com/repo", "1.0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].ID != configDigest.String() || infos[0].Size != int64(2*len(layer)) || len(infos[0].Layers) != 2 {
+		t.Fatalf("got %+v", infos)
+	}
+
+	m, err := s.GetManifest(ctx, "repo", "latest")
+	if err != nil || m.Digest != infos[0].Digest || digest.FromBytes(m.Data).String() != m.Digest {
+		t.Errorf("got %+v, %v", m, err)
+	}
+	blobs, _ := m.Blobs()
+	for _, d := range blobs {
+		rc, err := s.GetBlob(ctx, "repo", d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if digest.FromBytes(data).String() != d {
+			t.Errorf("%s: got different blob", d)
+		}
+	}
+
+	if _, _, err := Open("docker-archive:" + filepath.Join(t.TempDir(), "missing.tar")); err == nil {
+		t.Error("expected error for missing archive")
+	}
+}
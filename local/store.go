@@ -0,0 +1,139 @@
+package local
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// Maximum number of links followed in a tar archive
+const maxLinks = 255
+
+// store reads the files in a directory or in a tar archive
+type store interface {
+	open(name string) (io.ReadCloser, error)
+	size(name string) (int64, error)
+	Close() error
+}
+
+// openStore opens the directory or the tar archive
+func openStore(file string) (store, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return openTar(file)
+	}
+	root, err := os.OpenRoot(file)
+	if err != nil {
+		return nil, err
+	}
+	return &dirStore{root: root}, nil
+}
+
+type dirStore struct {
+	root *os.Root
+}
+
+func (s *dirStore) open(name string) (io.ReadCloser, error) {
+	return s.root.Open(name)
+}
+
+func (s *dirStore) size(name string) (int64, error) {
+	fi, err := s.root.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *dirStore) Close() error {
+	return s.root.Close()
+}
+
+// tarStore reads the files in an uncompressed tar archive in place
+type tarStore struct {
+	file  *os.File
+	files map[string]*io.SectionReader
+	links map[string]string // Targets of symbolic & hard links
+}
+
+// tarName returns the relative path of a tar entry
+func tarName(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// openTar indexes the regular files in the archive by their offset
+func openTar(file string) (*tarStore, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &tarStore{file: f, files: make(map[string]*io.SectionReader), links: make(map[string]string)}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		name := tarName(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			// The reader is right after the header
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			s.files[name] = io.NewSectionReader(f, offset, hdr.Size)
+		case tar.TypeSymlink:
+			s.links[name] = tarName(path.Join(path.Dir(name), hdr.Linkname))
+		case tar.TypeLink:
+			s.links[name] = tarName(hdr.Linkname)
+		}
+	}
+}
+
+// lookup returns the section of the archive with the file following links
+func (s *tarStore) lookup(name string) (*io.SectionReader, error) {
+	name = tarName(name)
+	for hops := 0; hops < maxLinks; hops++ {
+		if sr, ok := s.files[name]; ok {
+			return sr, nil
+		}
+		target, ok := s.links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (s *tarStore) open(name string) (io.ReadCloser, error) {
+	sr, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(io.NewSectionReader(sr, 0, sr.Size())), nil
+}
+
+func (s *tarStore) size(name string) (int64, error) {
+	sr, err := s.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return sr.Size(), nil
+}
+
+func (s *tarStore) Close() error {
+	return s.file.Close()
+}
@@ -7,7 +7,6 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
-	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -15,18 +14,26 @@ import (
 	"runtime"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"text/template"
 	"time"
 
+	"github.com/ricardobranco777/regview/local"
 	"github.com/ricardobranco777/regview/registry"
-	"mvdan.cc/sh/v3/pattern"
 )
 
 import flag "github.com/spf13/pflag"
 
 const version = "3.0.4"
 
+// Exit codes. Runs interrupted by a signal exit with 128 + the signal number like the shell does
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitErrors  = 2 // Some errors weren't fatal, whether or not anything succeeded
+)
+
 // ContextKey type for contexts
 type ContextKey string
 
@@ -36,6 +43,10 @@ var opts struct {
 	debug    bool
 	digests  bool
 	dryRun   bool
+	du       bool
+	files    bool
+	force    bool
+	prune    bool
 	insecure bool
 	noTrunc  bool
 	raw      bool
@@ -48,18 +59,39 @@ var opts struct {
 	password string
 	keypass  string
 	format   string
+	journal  string
+	restore  string
+	state    string
+	output   string
+	jobs     int
+	keep     int
+	retries  int
+	rate     float64
 	arch     []string
 	os       []string
+	protect  []string
+
+	olderThan    time.Duration
+	referrers    bool
+	ociLayout    bool
+	verifyKey    string
+	destUsername string
+	destPassword string
 }
 
 var (
-	format              = template.New("format")
-	ignoreTags          = regexp.MustCompile(`^sha(256|512)-[0-9a-f]{64,}\.(att|sig)$`) // Ignore stupid sigstore/cosign fake manifests & signatures
+	format              *template.Template
+	formatHeader        string
+	ignoreTags          = regexp.MustCompile(`^sha(256|512)-[0-9a-f]{64,}(\.(att|sig|sbom))?$`) // Ignore referrers tag schema & cosign tags. Use --referrers to see them
 	repoRegex, tagRegex *regexp.Regexp
 	repoWidth           int
+	interrupted         atomic.Pointer[os.Signal]
+	failures            atomic.Int64
 )
 
 func init() {
+	var olderThan string
+
 	log.SetFlags(0)
 	log.SetPrefix("ERROR: ")
 
@@ -68,6 +100,17 @@ func init() {
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: [OPTIONS] %s REGISTRY[/REPOSITORY[:TAG|@DIGEST]]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s oci:PATH[:TAG|@DIGEST]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s docker-archive:PATH[:REPOSITORY[:TAG|@DIGEST]]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s --restore JOURNAL\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s tag REGISTRY/REPOSITORY[:TAG|@DIGEST] [REGISTRY/REPOSITORY:]TAG\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s copy REGISTRY/REPOSITORY[:TAG|@DIGEST] REGISTRY[/REPOSITORY[:TAG]]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s sync REGISTRY[/REPOSITORY[:TAG]] REGISTRY[/PREFIX]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s ls REGISTRY/REPOSITORY[:TAG|@DIGEST][:PATH]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s cat REGISTRY/REPOSITORY[:TAG|@DIGEST]:PATH\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s find REGISTRY/REPOSITORY[:TAG|@DIGEST][:PATH] PATTERN\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s export REGISTRY/REPOSITORY[:TAG|@DIGEST] DIRECTORY\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       [OPTIONS] %s diff REGISTRY/REPOSITORY[:TAG|@DIGEST] REGISTRY/REPOSITORY[:TAG|@DIGEST]\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "Valid options for --arch: %s\n", strings.Join(arches, " "))
 		fmt.Fprintf(os.Stderr, "Valid options for --os: %s\n", strings.Join(oses, " "))
@@ -77,18 +120,37 @@ func init() {
 	flag.BoolVarP(&opts.debug, "debug", "", false, "Enable debug")
 	flag.BoolVarP(&opts.digests, "digests", "", false, "Show digests")
 	flag.BoolVarP(&opts.dryRun, "dry-run", "", false, "Used with --delete: only show the images that would be deleted")
+	flag.BoolVarP(&opts.force, "force", "", false, "Used with --delete: delete even if other tags reference the same digests")
+	flag.IntVarP(&opts.keep, "keep", "", 0, "Used with --delete: keep the newest N tags of each repository")
+	flag.StringSliceVarP(&opts.protect, "protect", "", []string{}, "Used with --delete: never delete tags matching this pattern. May be specified multiple times")
+	flag.StringVarP(&olderThan, "older-than", "", "", "Used with --delete: only delete tags older than this duration, like 720h or 30d")
+	flag.StringVarP(&opts.journal, "journal", "", "", "Used with --delete: directory where the deleted manifests are saved. Defaults to $XDG_STATE_HOME/regview. Empty to disable")
+	flag.StringVarP(&opts.restore, "restore", "", "", "Restore the manifests & tags deleted in this journal file")
+	flag.BoolVarP(&opts.du, "du", "", false, "Show the storage used by each tag, repository & the registry counting shared blobs once")
+	flag.BoolVarP(&opts.files, "files", "", false, "Used with diff: also compare the files in the layers")
 	flag.BoolVarP(&opts.insecure, "insecure", "", false, "Allow insecure server connections")
 	flag.BoolVarP(&opts.noTrunc, "no-trunc", "", false, "Don't truncate output")
+	flag.BoolVarP(&opts.ociLayout, "oci-layout", "", false, "Used with export: write an OCI image layout instead of the root filesystem")
 	flag.BoolVarP(&opts.raw, "raw", "", false, "Raw values for date and size")
+	flag.BoolVarP(&opts.referrers, "referrers", "", false, "Show the artifacts attached to images like signatures, SBOMs & attestations")
 	flag.BoolVarP(&opts.verbose, "verbose", "v", false, "Show more information")
+	flag.StringVarP(&opts.verifyKey, "verify-key", "", "", "Verify the cosign signatures of the images with this public key")
 	flag.BoolVarP(&opts.version, "version", "", false, "Show version and exit")
 	flag.StringVarP(&opts.username, "user", "u", "", "Username for authentication")
 	flag.StringVarP(&opts.password, "pass", "p", "", "Password for authentication")
+	flag.StringVarP(&opts.destUsername, "dest-user", "", "", "Used with copy & sync: username for the destination registry")
+	flag.StringVarP(&opts.destPassword, "dest-pass", "", "", "Used with copy & sync: password for the destination registry")
+	flag.BoolVarP(&opts.prune, "prune", "", false, "Used with sync: delete synced tags that vanished from the source")
+	flag.StringVarP(&opts.state, "state", "", "", "Used with sync: state file. Defaults to a file under $XDG_STATE_HOME/regview/sync")
 	flag.StringVarP(&opts.cacert, "tlscacert", "C", "", "Trust certs signed only by this CA")
 	flag.StringVarP(&opts.cert, "tlscert", "c", "", "Path to TLS certificate file")
 	flag.StringVarP(&opts.key, "tlskey", "k", "", "Path to TLS key file")
 	flag.StringVarP(&opts.keypass, "tlskeypass", "P", "", "Passphrase for TLS key file")
-	flag.StringVarP(&opts.format, "format", "f", "", "Output format")
+	flag.StringVarP(&opts.format, "format", "f", "", "Output format using a Go template. Prefix with \"table\" to print a header")
+	flag.StringVarP(&opts.output, "output", "o", "", "Output format: "+strings.Join(outputFormats, "|"))
+	flag.IntVarP(&opts.jobs, "jobs", "j", 10, "Maximum number of concurrent requests")
+	flag.Float64VarP(&opts.rate, "rate", "", 0, "Maximum number of requests per second per host. 0 for unlimited")
+	flag.IntVarP(&opts.retries, "retries", "", 3, "Maximum number of retries for failed requests")
 	flag.StringSliceVarP(&opts.arch, "arch", "", []string{}, "Target architecture. May be specified multiple times")
 	flag.StringSliceVarP(&opts.os, "os", "", []string{}, "Target OS. May be specified multiple times")
 	flag.Parse()
@@ -103,11 +165,20 @@ func init() {
 			log.Fatalf("Invalid arch: %s\n", os)
 		}
 	}
+	if opts.jobs < 1 {
+		log.Fatalf("Invalid number of jobs: %d\n", opts.jobs)
+	}
+	if opts.retries < 0 {
+		log.Fatalf("Invalid number of retries: %d\n", opts.retries)
+	}
+	if opts.rate < 0 {
+		log.Fatalf("Invalid rate: %v\n", opts.rate)
+	}
 	if len(opts.arch) > 0 || len(opts.os) > 0 {
 		opts.all = true
 	}
-	// Filter by current arch & OS if neither --all, --arch or --os were specified
-	if !opts.all && len(opts.arch) == 0 && len(opts.os) == 0 {
+	// Filter by current arch & OS if neither --all, --arch or --os were specified. --du counts every platform
+	if !opts.all && !opts.du && len(opts.arch) == 0 && len(opts.os) == 0 {
 		opts.arch = []string{runtime.GOARCH}
 		opts.os = []string{runtime.GOOS}
 	}
@@ -128,9 +199,18 @@ func init() {
 		}
 	}
 
+	if opts.destPassword != "" {
+		if data, err := os.ReadFile(opts.destPassword); err == nil {
+			opts.destPassword = string(data)
+		}
+	}
+
 	if opts.username != "" && opts.password == "" {
 		opts.password = getPass("Password: ")
 	}
+	if opts.destUsername != "" && opts.destPassword == "" {
+		opts.destPassword = getPass("Password for %s: ", opts.destUsername)
+	}
 
 	if opts.cert != "" && opts.key != "" && opts.keypass == "" {
 		for _, file := range []string{opts.cert, opts.key} {
@@ -143,18 +223,56 @@ func init() {
 		}
 	}
 
-	if opts.delete {
+	if opts.du && (opts.delete || opts.format != "" || opts.output != "") {
+		log.Fatal("--du is mutually exclusive with --delete, --format & --output")
+	}
+	if opts.delete || opts.referrers || opts.verifyKey != "" {
+		opts.digests = true
+	}
+	if !flag.CommandLine.Changed("journal") {
+		opts.journal = stateDir()
+	}
+
+	if opts.output != "" {
+		if !slices.Contains(outputFormats, opts.output) {
+			log.Fatalf("Invalid output format: %s\n", opts.output)
+		}
+		if opts.format != "" {
+			log.Fatal("--format and --output are mutually exclusive")
+		}
 		opts.digests = true
+		opts.verbose = true
 	}
 
 	var err error
 
+	if olderThan != "" {
+		if opts.olderThan, err = parseDuration(olderThan); err != nil || opts.olderThan <= 0 {
+			log.Fatalf("Invalid duration: %s\n", olderThan)
+		}
+	}
+	if opts.verifyKey != "" {
+		if verifyKey, err = loadPublicKey(opts.verifyKey); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if opts.keep < 0 {
+		log.Fatalf("Invalid number of tags to keep: %d\n", opts.keep)
+	}
+	for _, protect := range opts.protect {
+		regex, err := globRegex(protect)
+		if err != nil {
+			log.Fatal(err)
+		}
+		protectRegexes = append(protectRegexes, regex)
+	}
+
 	if opts.format != "" {
-		format, err = format.Parse(opts.format)
+		format, formatHeader, err = parseFormat(opts.format)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if strings.Contains(opts.format, ".Image") {
+		if strings.Contains(opts.format, ".Image") || strings.Contains(opts.format, "label") {
 			opts.verbose = true
 		}
 	}
@@ -165,75 +283,155 @@ func init() {
 }
 
 func main() {
+	// On ^C, or SIGTERM cancel all requests and exit after flushing the output.
+	// A second signal exits immediately.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ContextKey(version), version))
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	signal.Notify(signals, syscall.SIGTERM)
+	signal.Notify(signals, syscall.SIGPIPE)
+	go func() {
+		for sig := range signals {
+			if interrupted.Load() != nil {
+				os.Exit(signalExitCode(sig))
+			}
+			interrupted.Store(&sig)
+			cancel()
+			log.Printf("Received %s, exiting\n", sig.String())
+		}
+	}()
+
+	if opts.restore != "" && flag.NArg() == 0 {
+		restoreJournal(ctx, opts.restore)
+		os.Exit(exitCode())
+	}
+	switch flag.Arg(0) {
+	case "tag", "copy", "sync", "export", "diff":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(exitFailure)
+		}
+		switch flag.Arg(0) {
+		case "tag":
+			tagImage(ctx, flag.Arg(1), flag.Arg(2))
+		case "copy":
+			copyImages(ctx, flag.Arg(1), flag.Arg(2))
+		case "sync":
+			syncImages(ctx, flag.Arg(1), flag.Arg(2))
+		case "export":
+			exportImage(ctx, flag.Arg(1), flag.Arg(2))
+		case "diff":
+			diffImage(ctx, flag.Arg(1), flag.Arg(2))
+		}
+		deleted.Close()
+		os.Exit(exitCode())
+	case "ls", "cat", "find":
+		nargs := 2
+		if flag.Arg(0) == "find" {
+			nargs = 3
+		}
+		if flag.NArg() != nargs {
+			flag.Usage()
+			os.Exit(exitFailure)
+		}
+		switch flag.Arg(0) {
+		case "ls":
+			lsImage(ctx, flag.Arg(1))
+		case "cat":
+			catImage(ctx, flag.Arg(1))
+		case "find":
+			findImage(ctx, flag.Arg(1), flag.Arg(2))
+		}
+		os.Exit(exitCode())
+	}
 	if flag.NArg() != 1 {
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 
-	var domain, path string
 	var repoPattern, tagPattern string
 
 	// Validate URL
 	arg := flag.Args()[0]
-	if !strings.HasPrefix(arg, "http:") && !strings.HasPrefix(arg, "https://") {
-		arg = "https://" + arg
-	}
-	u, err := url.Parse(arg)
-	if err != nil {
-		log.Fatalf("%s: %v\n", arg, err)
+	var domain, path string
+	var err error
+	if local.IsLocal(arg) {
+		if opts.delete || opts.referrers || verifyKey != nil {
+			log.Fatalf("%s: --delete, --referrers & --verify-key need a registry\n", arg)
+		}
+		if localStore, path, err = local.Open(arg); err != nil {
+			log.Fatal(err)
+		}
+		domain = arg
+	} else if domain, path, err = parseImageArg(arg); err != nil {
+		log.Fatal(err)
 	}
-	domain = u.Host
-	if u.Path != "" {
-		path = strings.TrimPrefix(arg, u.Scheme+"://"+u.Host+"/")
+	if path != "" {
 		if !strings.Contains(path, "@") && strings.ContainsAny(path, "*?[") {
 			v := strings.SplitN(path, ":", 2)
 			repoPattern = v[0]
 			if len(v) > 1 {
 				tagPattern = v[1]
 			}
-		} else if _, err := registry.ParseImage(u.Host + u.Path); err != nil {
+		} else if _, err := registry.ParseImage(domain + "/" + path); err != nil && localStore == nil {
 			log.Fatalf("%s: %v\n", arg, err)
+		} else if opts.delete && (opts.keep > 0 || opts.olderThan > 0) && !strings.Contains(path, "@") && !strings.Contains(path[strings.LastIndex(path, "/")+1:], ":") {
+			// Apply the retention policy to the repository
+			repoPattern = path
+		} else if opts.du {
+			if strings.Contains(path, "@") {
+				log.Fatalf("%s: --du needs a repository or a tag\n", arg)
+			}
+			repoPattern, tagPattern, _ = strings.Cut(path, ":")
 		}
 	}
 
 	// Convert shell patterns to regular expressions
 	if repoPattern != "" {
-		expr, err := pattern.Regexp(repoPattern, 0)
-		if err != nil {
-			log.Fatalf("%s: %v\n", repoPattern, err)
+		if repoRegex, err = globRegex(repoPattern); err != nil {
+			log.Fatal(err)
 		}
-		repoRegex = regexp.MustCompile("^" + expr + "$")
 	}
 	if tagPattern != "" {
-		expr, err := pattern.Regexp(tagPattern, 0)
-		if err != nil {
-			log.Fatalf("%s: %v\n", tagPattern, err)
+		if tagRegex, err = globRegex(tagPattern); err != nil {
+			log.Fatal(err)
 		}
-		tagRegex = regexp.MustCompile("^" + expr + "$")
 	}
 
-	// On ^C, or SIGTERM handle exit.
-	ctx := context.WithValue(context.Background(), ContextKey(version), version)
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
-	signal.Notify(signals, syscall.SIGTERM)
-	signal.Notify(signals, syscall.SIGPIPE)
-	_, cancel := context.WithCancel(ctx)
-	go func() {
-		for sig := range signals {
-			cancel()
-			log.Printf("Received %s, exiting\n", sig.String())
-			os.Exit(0)
-		}
-	}()
-
 	if path != "" && repoPattern == "" {
 		if opts.delete {
 			deleteImage(ctx, domain, path)
 		} else {
 			printImage(ctx, domain, path)
 		}
+	} else if opts.delete {
+		checkPrunePolicy(repoPattern, tagPattern)
+		pruneAll(ctx, domain)
+	} else if opts.du {
+		duAll(ctx, domain)
 	} else {
 		printAll(ctx, domain)
 	}
+
+	deleted.Close()
+	os.Exit(exitCode())
+}
+
+// exitCode returns the exit code for the run
+func exitCode() int {
+	if sig := interrupted.Load(); sig != nil {
+		return signalExitCode(*sig)
+	}
+	if failures.Load() > 0 {
+		return exitErrors
+	}
+	return exitSuccess
+}
+
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return exitFailure
 }
@@ -18,7 +18,8 @@ package oci
 
 import (
 	"time"
-	//	digest "github.com/opencontainers/go-digest"
+
+	digest "github.com/opencontainers/go-digest"
 )
 
 // ImageConfig defines the execution parameters which should be used as a base when running a container using an image.
@@ -51,10 +52,50 @@ type ImageConfig struct {
 
 	// StopSignal contains the system call signal that will be sent to the container to exit.
 	StopSignal string `json:"StopSignal,omitempty"`
+
+	// StopTimeout is the timeout in seconds to stop the container. Docker extension.
+	StopTimeout *int `json:"StopTimeout,omitempty"`
+
+	// Healthcheck describes how to check the container is healthy. Docker extension.
+	Healthcheck *HealthConfig `json:"Healthcheck,omitempty"`
+
+	// OnBuild contains the instructions to run when the image is used as a base. Docker extension.
+	OnBuild []string `json:"OnBuild,omitempty"`
+
+	// Shell is the shell used for the shell form of RUN, CMD & ENTRYPOINT. Docker extension.
+	Shell []string `json:"Shell,omitempty"`
+
+	// ArgsEscaped is true if the command is already escaped. Windows specific Docker extension.
+	ArgsEscaped bool `json:"ArgsEscaped,omitempty"`
+}
+
+// HealthConfig holds the configuration of the healthcheck. Docker extension.
+//
+//easyjson:skip
+type HealthConfig struct {
+	// Test is the test to perform. It's empty to inherit, ["NONE"] to disable,
+	// ["CMD", args...] to exec the arguments directly or ["CMD-SHELL", command] to run the command with the shell.
+	Test []string `json:"Test,omitempty"`
+
+	// Interval is the time to wait between checks.
+	Interval time.Duration `json:"Interval,omitempty"`
+
+	// Timeout is the time to wait before considering the check to have hung.
+	Timeout time.Duration `json:"Timeout,omitempty"`
+
+	// StartPeriod is the time for the container to initialize before starting health-retries countdown.
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+
+	// StartInterval is the time to wait between checks during the start period.
+	StartInterval time.Duration `json:"StartInterval,omitempty"`
+
+	// Retries is the number of consecutive failures needed to consider a container as unhealthy.
+	Retries int `json:"Retries,omitempty"`
 }
 
-/*
 // RootFS describes a layer content addresses
+//
+//easyjson:skip
 type RootFS struct {
 	// Type is the type of the rootfs.
 	Type string `json:"type"`
@@ -62,7 +103,6 @@ type RootFS struct {
 	// DiffIDs is an array of layer content hashes (DiffIDs), in order from bottom-most to top-most.
 	DiffIDs []digest.Digest `json:"diff_ids"`
 }
-*/
 
 // History describes the history of a layer.
 //
@@ -96,16 +136,29 @@ type Image struct {
 	// Architecture is the CPU architecture which the binaries in this image are built to run on.
 	Architecture string `json:"architecture"`
 
+	// Variant is the variant of the specified CPU architecture.
+	Variant string `json:"variant,omitempty"`
+
 	// OS is the name of the operating system which the image is built to run on.
 	OS string `json:"os"`
 
+	// OSVersion specifies the version of the operating system targeted by the referenced blob.
+	OSVersion string `json:"os.version,omitempty"`
+
+	// OSFeatures specifies an array of strings, each listing a required OS feature.
+	OSFeatures []string `json:"os.features,omitempty"`
+
 	// Config defines the execution parameters which should be used as a base when running a container using the image.
 	Config ImageConfig `json:"config"`
 
-	/*
-		// RootFS references the layer content addresses used by the image.
-		RootFS RootFS `json:"rootfs"`
-	*/
+	// RootFS references the layer content addresses used by the image.
+	RootFS RootFS `json:"rootfs"`
+
+	// ContainerConfig is the configuration of the container used to commit the image. Docker extension.
+	ContainerConfig *ImageConfig `json:"container_config,omitempty"`
+
+	// DockerVersion is the version of Docker that built the image. Docker extension.
+	DockerVersion string `json:"docker_version,omitempty"`
 
 	// History describes the history of each layer.
 	History []History `json:"history,omitempty"`
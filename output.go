@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+	"gopkg.in/yaml.v3"
+)
+
+var outputFormats = []string{"json", "ndjson", "yaml", "csv"}
+
+// record is the schema for --output. Fields may be added but never renamed or removed
+type record struct {
+	Repository      string        `json:"repository" yaml:"repository"`
+	Tag             string        `json:"tag" yaml:"tag"`
+	Digest          string        `json:"digest,omitempty" yaml:"digest,omitempty"`
+	IndexDigest     string        `json:"index_digest,omitempty" yaml:"index_digest,omitempty"`
+	ID              string        `json:"id" yaml:"id"`
+	Platform        *platform     `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Size            int64         `json:"size" yaml:"size"`
+	Created         *time.Time    `json:"created,omitempty" yaml:"created,omitempty"`
+	Author          string        `json:"author,omitempty" yaml:"author,omitempty"`
+	Config          *config       `json:"config,omitempty" yaml:"config,omitempty"`
+	RootFS          *rootfs       `json:"rootfs,omitempty" yaml:"rootfs,omitempty"`
+	DockerVersion   string        `json:"docker_version,omitempty" yaml:"docker_version,omitempty"`
+	ContainerConfig *config       `json:"container_config,omitempty" yaml:"container_config,omitempty"`
+	History         []history     `json:"history,omitempty" yaml:"history,omitempty"`
+	Layers          []layer       `json:"layers,omitempty" yaml:"layers,omitempty"`
+	Referrers       []referrer    `json:"referrers,omitempty" yaml:"referrers,omitempty"`
+	Signature       string        `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Attestations    []attestation `json:"attestations,omitempty" yaml:"attestations,omitempty"`
+}
+
+type platform struct {
+	OS           string   `json:"os" yaml:"os"`
+	Architecture string   `json:"architecture" yaml:"architecture"`
+	Variant      string   `json:"variant,omitempty" yaml:"variant,omitempty"`
+	OSVersion    string   `json:"os_version,omitempty" yaml:"os_version,omitempty"`
+	OSFeatures   []string `json:"os_features,omitempty" yaml:"os_features,omitempty"`
+}
+
+type config struct {
+	User         string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Env          []string          `json:"env,omitempty" yaml:"env,omitempty"`
+	Entrypoint   []string          `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	Cmd          []string          `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	WorkingDir   string            `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
+	ExposedPorts []string          `json:"exposed_ports,omitempty" yaml:"exposed_ports,omitempty"`
+	Volumes      []string          `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	StopSignal   string            `json:"stop_signal,omitempty" yaml:"stop_signal,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	StopTimeout  *int              `json:"stop_timeout,omitempty" yaml:"stop_timeout,omitempty"`
+	Healthcheck  *healthConfig     `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+	OnBuild      []string          `json:"on_build,omitempty" yaml:"on_build,omitempty"`
+	Shell        []string          `json:"shell,omitempty" yaml:"shell,omitempty"`
+	ArgsEscaped  bool              `json:"args_escaped,omitempty" yaml:"args_escaped,omitempty"`
+}
+
+// healthConfig has the durations formatted like "30s"
+type healthConfig struct {
+	Test          []string `json:"test,omitempty" yaml:"test,omitempty"`
+	Interval      string   `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout       string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	StartPeriod   string   `json:"start_period,omitempty" yaml:"start_period,omitempty"`
+	StartInterval string   `json:"start_interval,omitempty" yaml:"start_interval,omitempty"`
+	Retries       int      `json:"retries,omitempty" yaml:"retries,omitempty"`
+}
+
+type rootfs struct {
+	Type    string   `json:"type" yaml:"type"`
+	DiffIDs []string `json:"diff_ids,omitempty" yaml:"diff_ids,omitempty"`
+}
+
+type history struct {
+	Created    *time.Time `json:"created,omitempty" yaml:"created,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty" yaml:"created_by,omitempty"`
+	Comment    string     `json:"comment,omitempty" yaml:"comment,omitempty"`
+	EmptyLayer bool       `json:"empty_layer,omitempty" yaml:"empty_layer,omitempty"`
+}
+
+type layer struct {
+	Digest    string `json:"digest" yaml:"digest"`
+	MediaType string `json:"media_type,omitempty" yaml:"media_type,omitempty"`
+	Type      string `json:"type" yaml:"type"`
+	Size      int64  `json:"size" yaml:"size"`
+	CreatedBy string `json:"created_by,omitempty" yaml:"created_by,omitempty"`
+}
+
+type referrer struct {
+	Digest       string            `json:"digest" yaml:"digest"`
+	MediaType    string            `json:"media_type,omitempty" yaml:"media_type,omitempty"`
+	ArtifactType string            `json:"artifact_type,omitempty" yaml:"artifact_type,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+type attestation struct {
+	PredicateType string `json:"predicate_type" yaml:"predicate_type"`
+	Digest        string `json:"digest" yaml:"digest"`
+	Packages      int    `json:"packages,omitempty" yaml:"packages,omitempty"`
+	BuilderID     string `json:"builder_id,omitempty" yaml:"builder_id,omitempty"`
+	Source        string `json:"source,omitempty" yaml:"source,omitempty"`
+	Commit        string `json:"commit,omitempty" yaml:"commit,omitempty"`
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// duration formats the duration leaving it empty if zero
+func duration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func newConfig(c *oci.ImageConfig) *config {
+	cfg := &config{
+		User:         c.User,
+		Env:          c.Env,
+		Entrypoint:   c.Entrypoint,
+		Cmd:          c.Cmd,
+		WorkingDir:   c.WorkingDir,
+		ExposedPorts: sortedKeys(c.ExposedPorts),
+		Volumes:      sortedKeys(c.Volumes),
+		StopSignal:   c.StopSignal,
+		Labels:       c.Labels,
+		StopTimeout:  c.StopTimeout,
+		OnBuild:      c.OnBuild,
+		Shell:        c.Shell,
+		ArgsEscaped:  c.ArgsEscaped,
+	}
+	if h := c.Healthcheck; h != nil {
+		cfg.Healthcheck = &healthConfig{
+			Test:          h.Test,
+			Interval:      duration(h.Interval),
+			Timeout:       duration(h.Timeout),
+			StartPeriod:   duration(h.StartPeriod),
+			StartInterval: duration(h.StartInterval),
+			Retries:       h.Retries,
+		}
+	}
+	return cfg
+}
+
+func newRecord(info *registry.Info) *record {
+	rec := &record{
+		Repository:  info.Repo,
+		Tag:         info.Ref,
+		Digest:      info.Digest,
+		IndexDigest: info.DigestAll,
+		ID:          info.ID,
+		Size:        info.Size,
+		Signature:   info.Signature,
+	}
+
+	if info.Platform != nil {
+		rec.Platform = &platform{
+			OS:           info.Platform.OS,
+			Architecture: info.Platform.Architecture,
+			Variant:      info.Platform.Variant,
+			OSVersion:    info.Platform.OSVersion,
+			OSFeatures:   info.Platform.OSFeatures,
+		}
+	}
+
+	if image := info.Image; image != nil {
+		if rec.Platform == nil {
+			rec.Platform = &platform{
+				OS:           image.OS,
+				Architecture: image.Architecture,
+				Variant:      image.Variant,
+				OSVersion:    image.OSVersion,
+				OSFeatures:   image.OSFeatures,
+			}
+		}
+		rec.Created = image.Created
+		rec.Author = image.Author
+		rec.Config = newConfig(&image.Config)
+		if image.ContainerConfig != nil {
+			rec.ContainerConfig = newConfig(image.ContainerConfig)
+		}
+		rec.DockerVersion = image.DockerVersion
+		if image.RootFS.Type != "" || len(image.RootFS.DiffIDs) > 0 {
+			rec.RootFS = &rootfs{Type: image.RootFS.Type}
+			for _, d := range image.RootFS.DiffIDs {
+				rec.RootFS.DiffIDs = append(rec.RootFS.DiffIDs, d.String())
+			}
+		}
+		for _, h := range image.History {
+			rec.History = append(rec.History, history{
+				Created:    h.Created,
+				CreatedBy:  h.CreatedBy,
+				Comment:    h.Comment,
+				EmptyLayer: h.EmptyLayer,
+			})
+		}
+	}
+
+	createdBy := layerHistory(info.Image)
+	for i, l := range info.Layers {
+		rec.Layers = append(rec.Layers, layer{
+			Digest:    l.Digest.String(),
+			MediaType: l.MediaType,
+			Type:      layerType(l.MediaType),
+			Size:      l.Size,
+		})
+		if i < len(createdBy) {
+			rec.Layers[i].CreatedBy = createdBy[i]
+		}
+	}
+
+	for _, d := range info.Referrers {
+		rec.Referrers = append(rec.Referrers, referrer{
+			Digest:       d.Digest.String(),
+			MediaType:    d.MediaType,
+			ArtifactType: d.ArtifactType,
+			Annotations:  d.Annotations,
+		})
+	}
+
+	for _, a := range info.Attestations {
+		rec.Attestations = append(rec.Attestations, attestation{
+			PredicateType: a.PredicateType,
+			Digest:        a.Digest,
+			Packages:      a.Packages,
+			BuilderID:     a.BuilderID,
+			Source:        a.Source,
+			Commit:        a.Commit,
+		})
+	}
+
+	return rec
+}
+
+// recordWriter writes records in one of the --output formats
+type recordWriter interface {
+	Write(rec *record) error
+	Close() error
+}
+
+func newRecordWriter(w io.Writer, format string) recordWriter {
+	switch format {
+	case "json":
+		return &jsonWriter{w: w}
+	case "ndjson":
+		return &ndjsonWriter{enc: json.NewEncoder(w)}
+	case "yaml":
+		return &yamlWriter{w: w}
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}
+	}
+	panic("invalid output format: " + format)
+}
+
+// jsonWriter writes a JSON array as the records come
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (w *jsonWriter) Write(rec *record) error {
+	data, err := json.MarshalIndent(rec, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if w.count == 0 {
+		sep = "[\n  "
+	}
+	w.count++
+	_, err = fmt.Fprintf(w.w, "%s%s", sep, data)
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	if w.count == 0 {
+		_, err := fmt.Fprintln(w.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(w.w, "\n]")
+	return err
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(rec *record) error {
+	return w.enc.Encode(rec)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// yamlWriter writes a YAML sequence as the records come
+type yamlWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (w *yamlWriter) Write(rec *record) error {
+	data, err := yaml.Marshal([]*record{rec})
+	if err != nil {
+		return err
+	}
+	w.count++
+	_, err = w.w.Write(data)
+	return err
+}
+
+func (w *yamlWriter) Close() error {
+	if w.count == 0 {
+		_, err := fmt.Fprintln(w.w, "[]")
+		return err
+	}
+	return nil
+}
+
+var csvHeader = []string{"repository", "tag", "digest", "index_digest", "id", "os", "architecture", "variant", "size", "created", "labels"}
+
+// csvWriter writes the fields that fit in a column. Labels are encoded as a JSON object
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (w *csvWriter) Write(rec *record) error {
+	if !w.header {
+		w.header = true
+		if err := w.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	var os, arch, variant, created, labels string
+	if rec.Platform != nil {
+		os, arch, variant = rec.Platform.OS, rec.Platform.Architecture, rec.Platform.Variant
+	}
+	if rec.Created != nil {
+		created = rec.Created.Format(time.RFC3339)
+	}
+	if rec.Config != nil && len(rec.Config.Labels) > 0 {
+		data, err := json.Marshal(rec.Config.Labels)
+		if err != nil {
+			return err
+		}
+		labels = string(data)
+	}
+
+	if err := w.w.Write([]string{rec.Repository, rec.Tag, rec.Digest, rec.IndexDigest, rec.ID, os, arch, variant, strconv.FormatInt(rec.Size, 10), created, labels}); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error {
+	if !w.header {
+		if err := w.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
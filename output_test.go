@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+	"gopkg.in/yaml.v3"
+)
+
+func testRecords() []*record {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	info := &registry.Info{
+		Repo:      "library/alpine",
+		Ref:       "3.19",
+		Digest:    "sha256:aaaa",
+		DigestAll: "sha256:bbbb",
+		ID:        "sha256:cccc",
+		Size:      1234,
+		Platform:  &oci.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		Image: &oci.Image{
+			Created: &created,
+			Config: oci.ImageConfig{
+				Cmd:          []string{"/bin/sh"},
+				ExposedPorts: map[string]struct{}{"80/tcp": {}, "443/tcp": {}},
+				Labels:       map[string]string{"a": "b,c"},
+			},
+			History: []oci.History{{CreatedBy: "ADD file:abc in /"}},
+		},
+	}
+	return []*record{newRecord(info), newRecord(&registry.Info{Repo: "foo", Ref: "latest", ID: "sha256:dddd"})}
+}
+
+func TestRecordWriters(t *testing.T) {
+	records := testRecords()
+
+	for _, format := range outputFormats {
+		var buf bytes.Buffer
+		w := newRecordWriter(&buf, format)
+		for _, rec := range records {
+			if err := w.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []*record
+		switch format {
+		case "json":
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("%s: %v: %s", format, err, buf.String())
+			}
+		case "ndjson":
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var rec record
+				if err := dec.Decode(&rec); err != nil {
+					t.Fatalf("%s: %v", format, err)
+				}
+				got = append(got, &rec)
+			}
+		case "yaml":
+			if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("%s: %v: %s", format, err, buf.String())
+			}
+		case "csv":
+			rows, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			want := [][]string{
+				csvHeader,
+				{"library/alpine", "3.19", "sha256:aaaa", "sha256:bbbb", "sha256:cccc", "linux", "arm", "v7", "1234", "2024-01-02T03:04:05Z", `{"a":"b,c"}`},
+				{"foo", "latest", "", "", "sha256:dddd", "", "", "", "0", "", ""},
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("%s: got %q; want %q", format, rows, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("%s: got %+v; want %+v", format, got, records)
+		}
+	}
+}
+
+func TestRecordWritersEmpty(t *testing.T) {
+	for format, want := range map[string]string{
+		"json":   "[]\n",
+		"ndjson": "",
+		"yaml":   "[]\n",
+		"csv":    "repository,tag,digest,index_digest,id,os,architecture,variant,size,created,labels\n",
+	} {
+		var buf bytes.Buffer
+		if err := newRecordWriter(&buf, format).Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%s: got %q; want %q", format, buf.String(), want)
+		}
+	}
+}
+
+func TestNewRecordLayers(t *testing.T) {
+	info := &registry.Info{
+		Repo: "foo",
+		Ref:  "latest",
+		ID:   "sha256:dddd",
+		Layers: []oci.Descriptor{
+			{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Digest: "sha256:1111", Size: 100},
+			{MediaType: oci.MediaTypeImageLayerZstd, Digest: "sha256:2222", Size: 200},
+			{MediaType: oci.MediaTypeImageLayer, Digest: "sha256:3333", Size: 300},
+		},
+		Image: &oci.Image{
+			History: []oci.History{
+				{CreatedBy: "ADD file:abc in /"},
+				{CreatedBy: "ENV FOO=bar", EmptyLayer: true},
+				{CreatedBy: "RUN apk add curl"},
+				{CreatedBy: "COPY . /app"},
+			},
+		},
+	}
+
+	want := []layer{
+		{Digest: "sha256:1111", MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Type: "gzip", Size: 100, CreatedBy: "ADD file:abc in /"},
+		{Digest: "sha256:2222", MediaType: oci.MediaTypeImageLayerZstd, Type: "zstd", Size: 200, CreatedBy: "RUN apk add curl"},
+		{Digest: "sha256:3333", MediaType: oci.MediaTypeImageLayer, Type: "uncompressed", Size: 300, CreatedBy: "COPY . /app"},
+	}
+	if got := newRecord(info).Layers; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	for mediaType, want := range map[string]string{
+		"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip": "foreign",
+		oci.MediaTypeImageLayerNonDistributableGzip:                 "nondistributable",
+		"application/octet-stream":                                  "unknown",
+	} {
+		if got := layerType(mediaType); got != want {
+			t.Errorf("layerType(%q) = %q; want %q", mediaType, got, want)
+		}
+	}
+}
+
+func TestNewRecordConfig(t *testing.T) {
+	data := `{
+		"architecture": "arm64", "variant": "v8", "os": "linux", "docker_version": "24.0.7",
+		"config": {
+			"Env": ["PATH=/usr/bin"], "Cmd": ["/app"], "StopTimeout": 30, "OnBuild": ["RUN make"], "Shell": ["/bin/bash", "-c"],
+			"Healthcheck": {"Test": ["CMD-SHELL", "curl -f http://localhost/"], "Interval": 30000000000, "Retries": 3}
+		},
+		"container_config": {"Cmd": ["/bin/sh", "-c", "#(nop) CMD [\"/app\"]"]},
+		"rootfs": {"type": "layers", "diff_ids": ["sha256:1111", "sha256:2222"]}
+	}`
+	var image oci.Image
+	if err := image.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := newRecord(&registry.Info{Repo: "foo", Ref: "latest", ID: "sha256:dddd", Image: &image})
+	if rec.Platform.Variant != "v8" || rec.DockerVersion != "24.0.7" {
+		t.Errorf("got platform %+v & docker version %q", rec.Platform, rec.DockerVersion)
+	}
+	if !reflect.DeepEqual(rec.Config.Env, []string{"PATH=/usr/bin"}) || rec.Config.StopTimeout == nil || *rec.Config.StopTimeout != 30 {
+		t.Errorf("got config %+v", rec.Config)
+	}
+	wantHealth := &healthConfig{Test: []string{"CMD-SHELL", "curl -f http://localhost/"}, Interval: "30s", Retries: 3}
+	if !reflect.DeepEqual(rec.Config.Healthcheck, wantHealth) {
+		t.Errorf("got healthcheck %+v; want %+v", rec.Config.Healthcheck, wantHealth)
+	}
+	if !reflect.DeepEqual(rec.Config.OnBuild, []string{"RUN make"}) || !reflect.DeepEqual(rec.Config.Shell, []string{"/bin/bash", "-c"}) {
+		t.Errorf("got on_build %q & shell %q", rec.Config.OnBuild, rec.Config.Shell)
+	}
+	if rec.ContainerConfig == nil || len(rec.ContainerConfig.Cmd) != 3 {
+		t.Errorf("got container config %+v", rec.ContainerConfig)
+	}
+	wantRootFS := &rootfs{Type: "layers", DiffIDs: []string{"sha256:1111", "sha256:2222"}}
+	if !reflect.DeepEqual(rec.RootFS, wantRootFS) {
+		t.Errorf("got rootfs %+v; want %+v", rec.RootFS, wantRootFS)
+	}
+	if got, want := healthcheck(image.Config.Healthcheck), "CMD-SHELL curl -f http://localhost/ --interval=30s --retries=3"; got != want {
+		t.Errorf("healthcheck() = %q; want %q", got, want)
+	}
+}
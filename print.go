@@ -1,9 +1,11 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"reflect"
@@ -12,7 +14,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"text/tabwriter"
+	"time"
 
+	"github.com/ricardobranco777/regview/local"
 	"github.com/ricardobranco777/regview/oci"
 	"github.com/ricardobranco777/regview/registry"
 	"github.com/ricardobranco777/regview/repoutils"
@@ -20,19 +25,21 @@ import (
 	concurrently "github.com/tejzpr/ordered-concurrently/v3"
 )
 
+// formatOut is where --format writes. A tabwriter for table formats
+var formatOut io.Writer = os.Stdout
+
 type loadWorker struct {
-	reg  *registry.Registry
+	reg  registry.Backend
 	repo string
 }
 
-var maxWorkers = 10
-
 func (w *loadWorker) Run(ctx context.Context) any {
 	tags, err := w.reg.Tags(ctx, w.repo)
 	if err != nil {
-		log.Printf("%s: %v\n", w.repo, err)
+		logError(ctx, "%s: %v\n", w.repo, err)
 		return []*registry.Info{}
 	}
+	allTags := tags
 	tags = filterRegex(tags, tagRegex, false)
 	tags = filterRegex(tags, ignoreTags, true)
 	sort.Strings(tags)
@@ -49,7 +56,7 @@ func (w *loadWorker) Run(ctx context.Context) any {
 			if err != nil {
 				// Ignore this error that can happen when manifests may be available but not for this platform
 				if err.Error() != "MANIFEST_UNKNOWN" {
-					log.Printf("%s:%s: %v\n", w.repo, tag, err)
+					logError(ctx, "%s:%s: %v\n", w.repo, tag, err)
 				}
 				return
 			}
@@ -67,6 +74,10 @@ func (w *loadWorker) Run(ctx context.Context) any {
 		}
 	}
 
+	if r, ok := w.reg.(*registry.Registry); ok {
+		addArtifacts(ctx, r, w.repo, xinfos, allTags)
+	}
+
 	if !opts.all && !opts.verbose {
 		return xinfos
 	}
@@ -84,7 +95,7 @@ func (w *loadWorker) Run(ctx context.Context) any {
 			defer wg.Done()
 			blob, err := w.reg.GetImage(ctx, w.repo, id)
 			if err != nil {
-				log.Printf("%s@%s: %v\n", w.repo, id, err)
+				logError(ctx, "%s@%s: %v\n", w.repo, id, err)
 				return
 			}
 			m.Lock()
@@ -101,8 +112,24 @@ func (w *loadWorker) Run(ctx context.Context) any {
 	return xinfos
 }
 
+// localStore is the OCI image layout or docker archive given as argument, if any
+var localStore local.Store
+
+// openBackend returns the local store given as argument or a client for the registry
+func openBackend(ctx context.Context, domain string) (registry.Backend, error) {
+	if localStore != nil {
+		return localStore, nil
+	}
+	return createRegistryClient(ctx, domain)
+}
+
 func createRegistryClient(ctx context.Context, domain string) (*registry.Registry, error) {
-	auth, err := repoutils.GetAuthConfig(opts.username, opts.password, domain)
+	return newRegistryClient(ctx, domain, opts.username, opts.password)
+}
+
+// newRegistryClient creates a client with the credentials, if any, or those in the docker config
+func newRegistryClient(ctx context.Context, domain string, username string, password string) (*registry.Registry, error) {
+	auth, err := repoutils.GetAuthConfig(username, password, domain)
 	if err != nil {
 		return nil, err
 	}
@@ -122,17 +149,42 @@ func createRegistryClient(ctx context.Context, domain string) (*registry.Registr
 		Insecure:   opts.insecure,
 		NonSSL:     opts.insecure,
 		Passphrase: opts.keypass,
+		Jobs:       opts.jobs,
+		Rate:       opts.rate,
+		Retries:    opts.retries,
 	})
 }
 
-func getInfos(ctx context.Context, r *registry.Registry, repo string, ref string) (infos []*registry.Info, err error) {
+// getInfos returns an error only if it couldn't get any info. Other errors are logged
+func getInfos(ctx context.Context, r registry.Backend, repo string, ref string) (infos []*registry.Info, err error) {
 	infos, err = r.GetInfoAll(ctx, repo, ref, opts.arch, opts.os)
 	if err != nil {
-		return []*registry.Info{}, err
+		if len(infos) == 0 {
+			return []*registry.Info{}, err
+		}
+		logErrors(ctx, "", err)
 	}
 	return infos, nil
 }
 
+// deleteRef deletes the reference after saving the manifest to the journal, logging any error.
+// It returns false if the reference couldn't be deleted
+func deleteRef(ctx context.Context, r *registry.Registry, repo string, ref string, index string, tags []string) bool {
+	found, err := backup(ctx, r, repo, ref, index, tags)
+	if err != nil {
+		logError(ctx, "%s %s: not deleting as the manifest couldn't be saved: %v\n", repo, ref, err)
+		return false
+	}
+	if !found {
+		return true
+	}
+	if err := r.Delete(ctx, repo, ref); err != nil {
+		logError(ctx, "%s %s: %v\n", repo, ref, err)
+		return false
+	}
+	return true
+}
+
 func deleteImage(ctx context.Context, domain string, image string) {
 	r, err := createRegistryClient(ctx, domain)
 	if err != nil {
@@ -145,25 +197,38 @@ func deleteImage(ctx context.Context, domain string, image string) {
 		log.Fatalf("%s %s: %v\n", repo, ref, err)
 	}
 
+	// Deleting a digest removes every tag pointing to it
+	var digests []string
 	for _, info := range infos {
+		digests = append(digests, info.Digest)
+	}
+	if opts.all && infos[0].DigestAll != "" {
+		digests = append(digests, infos[0].DigestAll)
+	}
+	refs := checkCollateral(ctx, r, repo, ref, digests)
+
+	for _, info := range infos {
+		if ctx.Err() != nil {
+			return
+		}
 		fmt.Printf("Deleting %s@%s\n", repo, info.Digest)
 		if !opts.dryRun {
-			r.Delete(ctx, repo, info.Digest)
+			deleteRef(ctx, r, repo, info.Digest, info.DigestAll, tagsFor(refs, info.Digest))
 		}
 	}
 
-	if opts.all {
+	if opts.all && ctx.Err() == nil {
 		// Also delete multi-arch digest
-		if infos[0].DigestAll != infos[0].Digest {
+		if infos[0].DigestAll != "" && infos[0].DigestAll != infos[0].Digest {
 			fmt.Printf("Deleting %s@%s\n", infos[0].Repo, infos[0].DigestAll)
 			if !opts.dryRun {
-				r.Delete(ctx, infos[0].Repo, infos[0].DigestAll)
+				deleteRef(ctx, r, infos[0].Repo, infos[0].DigestAll, "", tagsFor(refs, infos[0].DigestAll))
 			}
 		}
 		// OCI spec allows for deletions of tags
 		fmt.Printf("Deleting %s:%s\n", repo, ref)
 		if !opts.dryRun {
-			r.Delete(ctx, repo, ref)
+			deleteRef(ctx, r, repo, ref, "", []string{ref})
 		}
 	}
 }
@@ -178,6 +243,9 @@ func printHeader() {
 	} else {
 		fmt.Printf("  %-12s", "IMAGE ID")
 	}
+	if verifyKey != nil {
+		fmt.Printf("  %-9s", "SIGNATURE")
+	}
 	if opts.verbose {
 		fmt.Printf("  %-31s", "CREATED")
 	}
@@ -189,8 +257,8 @@ func printHeader() {
 
 func printInfo(info *registry.Info) {
 	if opts.format != "" {
-		format.Execute(os.Stdout, info)
-		fmt.Println()
+		format.Execute(formatOut, info)
+		fmt.Fprintln(formatOut)
 		return
 	}
 
@@ -204,6 +272,9 @@ func printInfo(info *registry.Info) {
 		v := strings.SplitN(info.ID, ":", 2)
 		fmt.Printf("  %-12s", v[1][:12])
 	}
+	if verifyKey != nil {
+		fmt.Printf("  %-9s", cmp.Or(info.Signature, "-"))
+	}
 	if opts.verbose {
 		if info.Image.Created != nil {
 			if opts.raw {
@@ -219,6 +290,76 @@ func printInfo(info *registry.Info) {
 		fmt.Printf("  %-8s  %s", info.Image.OS, info.Image.Architecture)
 	}
 	fmt.Println()
+	for _, d := range info.Referrers {
+		fmt.Printf("%-*s  %-72s  %s\n", repoWidth+20, "  \u2514\u2500", d.Digest, artifactType(d))
+	}
+}
+
+// healthcheck returns the test command followed by the options that are set
+func healthcheck(h *oci.HealthConfig) string {
+	if h == nil || len(h.Test) == 0 {
+		return ""
+	}
+	fields := []string{strings.Join(h.Test, " ")}
+	for _, option := range []struct {
+		name  string
+		value time.Duration
+	}{{"interval", h.Interval}, {"timeout", h.Timeout}, {"start-period", h.StartPeriod}, {"start-interval", h.StartInterval}} {
+		if option.value != 0 {
+			fields = append(fields, "--"+option.name+"="+option.value.String())
+		}
+	}
+	if h.Retries != 0 {
+		fields = append(fields, "--retries="+strconv.Itoa(h.Retries))
+	}
+	return strings.Join(fields, " ")
+}
+
+// layerType returns the compression of the layer or whether it's foreign or nondistributable
+func layerType(mediaType string) string {
+	switch {
+	case strings.Contains(mediaType, "foreign"):
+		return "foreign"
+	case strings.Contains(mediaType, "nondistributable"):
+		return "nondistributable"
+	case strings.HasSuffix(mediaType, "zstd"):
+		return "zstd"
+	case strings.HasSuffix(mediaType, "gzip"):
+		return "gzip"
+	case strings.HasSuffix(mediaType, ".tar"):
+		return "uncompressed"
+	}
+	return "unknown"
+}
+
+// layerHistory returns the commands that created each layer skipping the history entries of empty layers
+func layerHistory(image *oci.Image) []string {
+	if image == nil {
+		return nil
+	}
+	var history []string
+	for _, h := range image.History {
+		if !h.EmptyLayer {
+			history = append(history, strings.TrimSpace(h.CreatedBy))
+		}
+	}
+	return history
+}
+
+// attestationSummary returns the predicate type followed by the package count of SBOMs or the builder, source & commit of provenances
+func attestationSummary(a registry.Attestation) string {
+	var fields []string
+	switch a.PredicateType {
+	case registry.PredicateSPDX, registry.PredicateCycloneDX:
+		fields = append(fields, fmt.Sprintf("%d packages", a.Packages))
+	default:
+		for _, field := range []struct{ name, value string }{{"builder", a.BuilderID}, {"source", a.Source}, {"commit", a.Commit}} {
+			if field.value != "" {
+				fields = append(fields, field.name+"="+field.value)
+			}
+		}
+	}
+	return strings.TrimSpace(a.PredicateType + " " + strings.Join(fields, " "))
 }
 
 func printIt(format string, name string, it any) {
@@ -226,7 +367,7 @@ func printIt(format string, name string, it any) {
 	var b []byte
 
 	v := reflect.ValueOf(it)
-	if v.Len() == 0 {
+	if v.IsZero() || (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
 		return
 	}
 
@@ -250,43 +391,75 @@ func printIt(format string, name string, it any) {
 }
 
 func printImage(ctx context.Context, domain string, image string) {
-	r, err := createRegistryClient(ctx, domain)
+	b, err := openBackend(ctx, domain)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Deleting & looking for artifacts need a registry
+	r, _ := b.(*registry.Registry)
 
 	repo, ref, _ := repoutils.GetRepoAndRef(image)
-	infos, err := getInfos(ctx, r, repo, ref)
+	infos, err := getInfos(ctx, b, repo, ref)
 	if err != nil {
 		log.Fatalf("%s: %v\n", image, err)
 	}
 
+	if opts.referrers || verifyKey != nil {
+		// The tags are only needed to find cosign signatures & attestations
+		tags, _ := r.Tags(ctx, repo)
+		addArtifacts(ctx, r, repo, infos, tags)
+	}
+
+	var w recordWriter
+	if opts.output != "" {
+		w = newRecordWriter(os.Stdout, opts.output)
+		defer w.Close()
+	}
+
 	for _, info := range infos {
+		if ctx.Err() != nil {
+			break
+		}
 		if opts.delete {
 			fmt.Printf("Deleting %s@%s\n", repo, info.Digest)
 			if !opts.dryRun {
-				r.Delete(ctx, repo, info.Digest)
+				deleteRef(ctx, r, repo, info.Digest, info.DigestAll, nil)
 			}
 			continue
 		}
 
 		if opts.verbose {
-			info.Image, _ = r.GetImage(ctx, repo, info.ID)
+			if info.Image, err = b.GetImage(ctx, repo, info.ID); err != nil {
+				logError(ctx, "%s@%s: %v\n", repo, info.ID, err)
+			}
 		}
 
-		format := "%-20s\t%s\n"
-		if info.Image != nil {
-			// We also have to filter by arch & os because the registry may not return a list
-			if len(opts.arch) > 0 && !slices.Contains(opts.arch, info.Image.Architecture) {
-				continue
+		if info.Attestation != "" {
+			if info.Attestations, err = registry.GetAttestations(ctx, b, repo, info.Attestation); err != nil {
+				logError(ctx, "%s@%s: %v\n", repo, info.Attestation, err)
 			}
-			if len(opts.os) > 0 && !slices.Contains(opts.os, info.Image.OS) {
-				continue
+		}
+
+		if !matchPlatform(info) {
+			continue
+		}
+
+		if w != nil {
+			if err := w.Write(newRecord(info)); err != nil {
+				log.Fatal(err)
 			}
+			continue
+		}
+
+		format := "%-20s\t%s\n"
+		if info.Image != nil {
 			printIt(format, "Author", info.Image.Author)
 			if info.Platform == nil {
 				printIt(format, "Architecture", info.Image.Architecture)
+				printIt(format, "Variant", info.Image.Variant)
 				printIt(format, "OS", info.Image.OS)
+				printIt(format, "OSVersion", info.Image.OSVersion)
+				printIt(format, "OSFeatures", info.Image.OSFeatures)
 			}
 		}
 		if info.Platform != nil {
@@ -299,6 +472,7 @@ func printImage(ctx context.Context, domain string, image string) {
 		printIt(format, "Digest", info.Digest)
 		printIt(format, "DigestAll", info.DigestAll)
 		printIt(format, "Id", info.ID)
+		printIt(format, "Signature", info.Signature)
 		if opts.raw {
 			printIt("%-20s\t%s\n", "Size", strconv.FormatInt(info.Size, 10))
 		} else {
@@ -312,17 +486,46 @@ func printImage(ctx context.Context, domain string, image string) {
 					printIt(format, "Created", prettyTime(info.Image.Created))
 				}
 			}
+			printIt(format, "DockerVersion", info.Image.DockerVersion)
+			printIt(format, "ArgsEscaped", info.Image.Config.ArgsEscaped)
 			printIt(format, "Cmd", info.Image.Config.Cmd)
 			printIt(format, "Entrypoint", info.Image.Config.Entrypoint)
+			printIt(format, "Env", info.Image.Config.Env)
 			printIt(format, "ExposedPorts", info.Image.Config.ExposedPorts)
+			printIt(format, "Healthcheck", healthcheck(info.Image.Config.Healthcheck))
 			printIt(format, "Labels", info.Image.Config.Labels)
+			printIt(format, "OnBuild", info.Image.Config.OnBuild)
+			printIt(format, "Shell", info.Image.Config.Shell)
 			printIt(format, "StopSignal", info.Image.Config.StopSignal)
+			printIt(format, "StopTimeout", info.Image.Config.StopTimeout)
 			printIt(format, "User", info.Image.Config.User)
 			printIt(format, "Volumes", info.Image.Config.Volumes)
 			printIt(format, "WorkingDir", info.Image.Config.WorkingDir)
+			printIt(format, "ContainerConfig", info.Image.ContainerConfig)
 			for i := range info.Image.History {
 				fmt.Printf("History[%d]\t\t%s\n", i, info.Image.History[i].CreatedBy)
 			}
+			for i, d := range info.Image.RootFS.DiffIDs {
+				fmt.Printf("DiffIDs[%d]\t\t%s\n", i, d)
+			}
+		}
+		history := layerHistory(info.Image)
+		for i, layer := range info.Layers {
+			size := prettySize(layer.Size)
+			if opts.raw {
+				size = strconv.FormatInt(layer.Size, 10)
+			}
+			var createdBy string
+			if i < len(history) {
+				createdBy = history[i]
+			}
+			fmt.Printf("Layers[%d]\t\t%s %s %s %s\n", i, layer.Digest, layerType(layer.MediaType), size, createdBy)
+		}
+		for i, a := range info.Attestations {
+			fmt.Printf("Attestations[%d]\t%s\n", i, attestationSummary(a))
+		}
+		for i, d := range info.Referrers {
+			fmt.Printf("Referrers[%d]\t\t%s %s\n", i, d.Digest, artifactType(d))
 		}
 		fmt.Println()
 	}
@@ -331,13 +534,23 @@ func printImage(ctx context.Context, domain string, image string) {
 		// OCI spec allows for deletions of tags
 		fmt.Printf("Deleting %s %s\n", repo, ref)
 		if !opts.dryRun {
-			r.Delete(ctx, repo, ref)
+			deleteRef(ctx, r, repo, ref, "", []string{ref})
 		}
 	}
 }
 
-func printAll(ctx context.Context, domain string) {
-	r, err := createRegistryClient(ctx, domain)
+// matchPlatform filters by --arch & --os as the registry may not return a list
+func matchPlatform(info *registry.Info) bool {
+	if info.Image == nil {
+		return true
+	}
+	return (len(opts.arch) == 0 || slices.Contains(opts.arch, info.Image.Architecture)) &&
+		(len(opts.os) == 0 || slices.Contains(opts.os, info.Image.OS))
+}
+
+// listRepos returns the backend & the repositories matching the pattern sorted
+func listRepos(ctx context.Context, domain string) (registry.Backend, []string) {
+	r, err := openBackend(ctx, domain)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -345,42 +558,65 @@ func printAll(ctx context.Context, domain string) {
 	repos, err := r.Catalog(ctx, "")
 	if err != nil {
 		if _, ok := err.(*json.SyntaxError); ok {
-			log.Fatalf("domain %s is not a valid registry", r.Domain)
+			log.Fatalf("domain %s is not a valid registry", domain)
 		} else {
 			log.Fatal(err)
 		}
 	}
 	repos = filterRegex(repos, repoRegex, false)
 	sort.Strings(repos)
+	return r, repos
+}
 
-	repoWidth = getMax(repos)
-	if opts.format == "" {
-		printHeader()
-	}
-
+// loadAll loads the infos of the tags in the repositories concurrently calling fn with those matching the platform in order
+func loadAll(ctx context.Context, r registry.Backend, repos []string, fn func(info *registry.Info)) {
 	inputChan := make(chan concurrently.WorkFunction)
-	output := concurrently.Process(ctx, inputChan, &concurrently.Options{PoolSize: maxWorkers, OutChannelBuffer: maxWorkers})
+	output := concurrently.Process(ctx, inputChan, &concurrently.Options{PoolSize: opts.jobs, OutChannelBuffer: opts.jobs})
 
 	go func() {
+		defer close(inputChan)
 		for _, repo := range repos {
-			inputChan <- &loadWorker{reg: r, repo: repo}
+			select {
+			case inputChan <- &loadWorker{reg: r, repo: repo}:
+			case <-ctx.Done():
+				return
+			}
 		}
-		close(inputChan)
 	}()
 
 	for out := range output {
-		infos := out.Value.([]*registry.Info)
-		for _, info := range infos {
-			if info.Image != nil {
-				// We also have to filter by arch & os because the registry may not return a list
-				if len(opts.arch) > 0 && !slices.Contains(opts.arch, info.Image.Architecture) {
-					continue
-				}
-				if len(opts.os) > 0 && !slices.Contains(opts.os, info.Image.OS) {
-					continue
-				}
+		for _, info := range out.Value.([]*registry.Info) {
+			if matchPlatform(info) {
+				fn(info)
 			}
-			printInfo(info)
 		}
 	}
 }
+
+func printAll(ctx context.Context, domain string) {
+	r, repos := listRepos(ctx, domain)
+	repoWidth = getMax(repos)
+
+	var w recordWriter
+	if opts.output != "" {
+		w = newRecordWriter(os.Stdout, opts.output)
+		defer w.Close()
+	} else if opts.format == "" {
+		printHeader()
+	} else if formatHeader != "" {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		defer tw.Flush()
+		formatOut = tw
+		fmt.Fprintln(formatOut, formatHeader)
+	}
+
+	loadAll(ctx, r, repos, func(info *registry.Info) {
+		if w != nil {
+			if err := w.Write(newRecord(info)); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			printInfo(info)
+		}
+	})
+}
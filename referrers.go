@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Artifact types for the tags used by cosign before the referrers API
+var cosignTags = []struct{ suffix, artifactType string }{
+	{".sig", cosignSignatureType},
+	{".att", "application/vnd.dsse.envelope.v1+json"},
+	{".sbom", "application/vnd.dev.cosign.artifact.sbom.v1+json"},
+}
+
+// artifactType returns the artifact type of a referrer falling back to its media type
+func artifactType(d oci.Descriptor) string {
+	if d.ArtifactType != "" {
+		return d.ArtifactType
+	}
+	return d.MediaType
+}
+
+// getReferrers returns the referrers of the digest including those attached with cosign tags
+func getReferrers(ctx context.Context, r *registry.Registry, repo string, dgst string, tags map[string]bool) ([]oci.Descriptor, error) {
+	referrers, err := r.Referrers(ctx, repo, dgst, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cosign := range cosignTags {
+		tag := strings.Replace(dgst, ":", "-", 1) + cosign.suffix
+		if !tags[tag] {
+			continue
+		}
+		d, err := r.ManifestDigest(ctx, repo, tag)
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, oci.Descriptor{
+			Digest:       digest.Digest(d),
+			ArtifactType: cosign.artifactType,
+			Annotations:  map[string]string{oci.AnnotationRefName: tag},
+		})
+	}
+
+	return referrers, nil
+}
+
+// getAllReferrers returns the referrers of the digests of the manifests & their indexes, querying each only once.
+// Digests whose referrers couldn't be fetched are missing from the map
+func getAllReferrers(ctx context.Context, r *registry.Registry, repo string, infos []*registry.Info, tags []string) map[string][]oci.Descriptor {
+	tagSet := make(map[string]bool)
+	for _, tag := range tags {
+		tagSet[tag] = true
+	}
+
+	seen := make(map[string]bool)
+	var digests []string
+	for _, info := range infos {
+		for _, d := range []string{info.DigestAll, info.Digest} {
+			if d != "" && !seen[d] {
+				seen[d] = true
+				digests = append(digests, d)
+			}
+		}
+	}
+
+	digest2Referrers := make(map[string][]oci.Descriptor)
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	wg.Add(len(digests))
+	for _, d := range digests {
+		go func(d string) {
+			defer wg.Done()
+			referrers, err := getReferrers(ctx, r, repo, d, tagSet)
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				logError(ctx, "%s@%s: %v\n", repo, d, err)
+				return
+			}
+			digest2Referrers[d] = referrers
+		}(d)
+	}
+	wg.Wait()
+
+	return digest2Referrers
+}
+
+// addArtifacts sets the referrers and the signature status of each info as requested by --referrers & --verify-key
+func addArtifacts(ctx context.Context, r *registry.Registry, repo string, infos []*registry.Info, tags []string) {
+	if !opts.referrers && verifyKey == nil {
+		return
+	}
+
+	digest2Referrers := getAllReferrers(ctx, r, repo, infos, tags)
+
+	if opts.referrers {
+		for _, info := range infos {
+			info.Referrers = nil
+			if info.DigestAll != "" && info.DigestAll != info.Digest {
+				info.Referrers = append(info.Referrers, digest2Referrers[info.DigestAll]...)
+			}
+			info.Referrers = append(info.Referrers, digest2Referrers[info.Digest]...)
+		}
+	}
+
+	if verifyKey != nil {
+		addSignatures(ctx, r, repo, infos, digest2Referrers)
+	}
+}
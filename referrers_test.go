@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+)
+
+func Test_addArtifacts(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	r := f.client(t)
+	ctx := context.Background()
+
+	index := pushImage(f, "repo", "1.0")
+	sigTag := strings.Replace(index, ":", "-", 1) + ".sig"
+	sig := f.putManifest("repo", sigTag, oci.MediaTypeImageManifest, []byte(`{"schemaVersion":2,"layers":[]}`))
+
+	m, err := r.GetManifest(ctx, "repo", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, _ := m.Children()
+	infos := []*registry.Info{
+		{Repo: "repo", Ref: "1.0", Digest: children[0], DigestAll: index},
+		{Repo: "repo", Ref: "1.0", Digest: children[1], DigestAll: index},
+	}
+	saved := opts
+	defer func() { opts = saved }()
+	opts.referrers = true
+	addArtifacts(ctx, r, "repo", infos, []string{"1.0", sigTag})
+
+	for _, info := range infos {
+		if len(info.Referrers) != 1 {
+			t.Fatalf("%s: got %d referrers; want 1", info.Digest, len(info.Referrers))
+		}
+		d := info.Referrers[0]
+		if d.Digest.String() != sig || artifactType(d) != "application/vnd.dev.cosign.artifact.sig.v1+json" {
+			t.Errorf("%s: got %+v", info.Digest, d)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ricardobranco777/regview/oci"
+)
+
+// BuildKit adds the attestation manifests to the index with an unknown/unknown platform & these annotations
+// https://github.com/moby/buildkit/blob/master/docs/attestations/attestation-storage.md
+const (
+	annotationReferenceType   = "vnd.docker.reference.type"
+	annotationReferenceDigest = "vnd.docker.reference.digest"
+	attestationManifest       = "attestation-manifest"
+	mediaTypeInToto           = "application/vnd.in-toto+json"
+)
+
+// Predicate types of the in-toto statements we summarize
+const (
+	PredicateSPDX      = "https://spdx.dev/Document"
+	PredicateCycloneDX = "https://cyclonedx.org/bom"
+	PredicateSLSAv02   = "https://slsa.dev/provenance/v0.2"
+	PredicateSLSAv1    = "https://slsa.dev/provenance/v1"
+)
+
+// Keys of the BuildKit metadata in SLSA provenance
+const (
+	buildkitMetadataV02 = "https://mobyproject.org/buildkit@v1#metadata"
+	buildkitMetadataV1  = "buildkit_metadata"
+)
+
+// Attestation is the summary of an in-toto statement
+type Attestation struct {
+	PredicateType string
+	Digest        string // Digest of the statement
+	Packages      int    // Packages in SBOMs
+	BuilderID     string // Builder, source repository & commit in SLSA provenance
+	Source        string
+	Commit        string
+}
+
+type statement struct {
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+type configSource struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+type vcs struct {
+	VCS struct {
+		Source   string `json:"source"`
+		Revision string `json:"revision"`
+	} `json:"vcs"`
+}
+
+type provenanceV02 struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	Invocation struct {
+		ConfigSource configSource `json:"configSource"`
+	} `json:"invocation"`
+	Metadata map[string]json.RawMessage `json:"metadata"`
+}
+
+type provenanceV1 struct {
+	BuildDefinition struct {
+		ExternalParameters struct {
+			ConfigSource configSource `json:"configSource"`
+		} `json:"externalParameters"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata map[string]json.RawMessage `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// source returns the repository & commit preferring those in the BuildKit metadata
+func source(config configSource, metadata json.RawMessage) (string, string) {
+	var v vcs
+	if metadata != nil {
+		_ = json.Unmarshal(metadata, &v)
+	}
+	repo, commit := v.VCS.Source, v.VCS.Revision
+	if repo == "" {
+		repo = config.URI
+	}
+	if commit == "" {
+		commit = config.Digest["sha1"]
+	}
+	return repo, commit
+}
+
+// parseStatement summarizes an in-toto statement
+func parseStatement(data []byte) (*Attestation, error) {
+	var s statement
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	a := &Attestation{PredicateType: s.PredicateType}
+	var err error
+	switch s.PredicateType {
+	case PredicateSPDX:
+		var p struct {
+			Packages []struct{} `json:"packages"`
+		}
+		err = json.Unmarshal(s.Predicate, &p)
+		a.Packages = len(p.Packages)
+	case PredicateCycloneDX:
+		var p struct {
+			Components []struct{} `json:"components"`
+		}
+		err = json.Unmarshal(s.Predicate, &p)
+		a.Packages = len(p.Components)
+	case PredicateSLSAv02:
+		var p provenanceV02
+		err = json.Unmarshal(s.Predicate, &p)
+		a.BuilderID = p.Builder.ID
+		a.Source, a.Commit = source(p.Invocation.ConfigSource, p.Metadata[buildkitMetadataV02])
+	case PredicateSLSAv1:
+		var p provenanceV1
+		err = json.Unmarshal(s.Predicate, &p)
+		a.BuilderID = p.RunDetails.Builder.ID
+		a.Source, a.Commit = source(p.BuildDefinition.ExternalParameters.ConfigSource, p.RunDetails.Metadata[buildkitMetadataV1])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.PredicateType, err)
+	}
+	return a, nil
+}
+
+// GetAttestations returns the summaries of the in-toto statements in the attestation manifest
+func GetAttestations(ctx context.Context, b Backend, repo string, ref string) ([]Attestation, error) {
+	m, err := b.GetManifest(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	var manifest oci.Manifest
+	if err := manifest.UnmarshalJSON(m.Data); err != nil {
+		return nil, err
+	}
+
+	var attestations []Attestation
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != mediaTypeInToto {
+			continue
+		}
+		rc, err := b.GetBlob(ctx, repo, layer.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		a, err := parseStatement(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", layer.Digest, err)
+		}
+		a.Digest = layer.Digest.String()
+		attestations = append(attestations, *a)
+	}
+	return attestations, nil
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+
+	types "github.com/moby/moby/api/types/registry"
+	digest "github.com/opencontainers/go-digest"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      Attestation
+	}{
+		{
+			`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://spdx.dev/Document","predicate":{"spdxVersion":"SPDX-2.3","packages":[{"name":"a"},{"name":"b"}]}}`,
+			Attestation{PredicateType: PredicateSPDX, Packages: 2},
+		},
+		{
+			`{"predicateType":"https://cyclonedx.org/bom","predicate":{"components":[{"name":"a"}]}}`,
+			Attestation{PredicateType: PredicateCycloneDX, Packages: 1},
+		},
+		{
+			`{"predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"builder":{"id":"https://github.com/org/repo/actions/runs/1"},"invocation":{"configSource":{"uri":"https://github.com/org/repo.git#main","digest":{"sha1":"abc"}}}}}`,
+			Attestation{PredicateType: PredicateSLSAv02, BuilderID: "https://github.com/org/repo/actions/runs/1", Source: "https://github.com/org/repo.git#main", Commit: "abc"},
+		},
+		{
+			`{"predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"builder":{"id":""},"metadata":{"https://mobyproject.org/buildkit@v1#metadata":{"vcs":{"source":"https://github.com/org/repo","revision":"def"}}}}}`,
+			Attestation{PredicateType: PredicateSLSAv02, Source: "https://github.com/org/repo", Commit: "def"},
+		},
+		{
+			`{"predicateType":"https://slsa.dev/provenance/v1","predicate":{"buildDefinition":{"externalParameters":{"configSource":{"uri":"https://github.com/org/repo.git","digest":{"sha1":"123"}}}},"runDetails":{"builder":{"id":"builder"}}}}`,
+			Attestation{PredicateType: PredicateSLSAv1, BuilderID: "builder", Source: "https://github.com/org/repo.git", Commit: "123"},
+		},
+		{
+			`{"predicateType":"https://example.com/custom","predicate":{}}`,
+			Attestation{PredicateType: "https://example.com/custom"},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseStatement([]byte(test.statement))
+		if err != nil {
+			t.Errorf("%s: %v", test.want.PredicateType, err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("got %+v; want %+v", *got, test.want)
+		}
+	}
+
+	if _, err := parseStatement([]byte(`{"predicateType":"https://spdx.dev/Document","predicate":{"packages":1}}`)); err == nil {
+		t.Error("expected error for invalid predicate")
+	}
+}
+
+func TestGetInfoAllAttestation(t *testing.T) {
+	content := make(map[string]string)    // path -> body
+	mediaTypes := make(map[string]string) // path -> media type
+	put := func(path string, mediaType string, data string) string {
+		d := digest.FromString(data).String()
+		content[path+d] = data
+		mediaTypes[path+d] = mediaType
+		return d
+	}
+
+	manifest := put("/v2/repo/manifests/", oci.MediaTypeImageManifest, `{"schemaVersion":2,"config":{"digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":1},"layers":[]}`)
+	statement := put("/v2/repo/blobs/", "", `{"predicateType":"https://spdx.dev/Document","predicate":{"packages":[{}]}}`)
+	attestation := put("/v2/repo/manifests/", oci.MediaTypeImageManifest, fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":"%s","size":1},"layers":[{"mediaType":"application/vnd.in-toto+json","digest":"%s","size":1,"annotations":{"in-toto.io/predicate-type":"https://spdx.dev/Document"}}]}`, statement, statement))
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[{"digest":"%s","size":1,"platform":{"architecture":"amd64","os":"linux"}},{"digest":"%s","size":1,"platform":{"architecture":"unknown","os":"unknown"},"annotations":{"vnd.docker.reference.type":"attestation-manifest","vnd.docker.reference.digest":"%s"}}]}`, oci.MediaTypeImageIndex, manifest, attestation, manifest)
+	content["/v2/repo/manifests/latest"] = index
+	mediaTypes["/v2/repo/manifests/latest"] = oci.MediaTypeImageIndex
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := content[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypes[r.URL.Path])
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			w.Header().Set("Docker-Content-Digest", digest.FromString(data).String())
+		}
+		w.Write([]byte(data))
+	}))
+	defer ts.Close()
+
+	r, err := New(context.Background(), types.AuthConfig{ServerAddress: ts.URL}, Opt{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := r.GetInfoAll(context.Background(), "repo", "latest", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("got %d infos; want 1", len(infos))
+	}
+	if infos[0].Attestation != attestation {
+		t.Fatalf("got attestation %q; want %q", infos[0].Attestation, attestation)
+	}
+
+	attestations, err := GetAttestations(context.Background(), r, "repo", infos[0].Attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Attestation{PredicateType: PredicateSPDX, Digest: statement, Packages: 1}
+	if len(attestations) != 1 || attestations[0] != want {
+		t.Errorf("got %+v; want %+v", attestations, want)
+	}
+}
@@ -5,21 +5,22 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 )
 
 var (
-	bearerRegex = regexp.MustCompile(
-		`^\s*Bearer\s+(.*)$`)
-	basicRegex = regexp.MustCompile(`^\s*Basic\s+.*$`)
-
 	// ErrBasicAuth indicates that the repository requires basic rather than token authentication.
 	ErrBasicAuth = errors.New("basic auth required")
 )
 
+// challenge holds an authentication challenge as defined in RFC 7235
+type challenge struct {
+	Scheme string
+	Params map[string]string
+}
+
 func parseAuthHeader(header http.Header) (*authService, error) {
-	ch, err := parseChallenge(header.Get("www-authenticate"))
+	ch, err := parseChallenge(strings.Join(header.Values("www-authenticate"), ", "))
 	if err != nil {
 		return nil, err
 	}
@@ -28,46 +29,160 @@ func parseAuthHeader(header http.Header) (*authService, error) {
 }
 
 func parseChallenge(challengeHeader string) (*authService, error) {
-	if basicRegex.MatchString(challengeHeader) {
-		return nil, ErrBasicAuth
+	challenges, err := parseChallenges(challengeHeader)
+	if err != nil {
+		return nil, fmt.Errorf("malformed auth challenge header: '%s': %v", challengeHeader, err)
 	}
 
-	match := bearerRegex.FindAllStringSubmatch(challengeHeader, -1)
-	if d := len(match); d != 1 {
-		return nil, fmt.Errorf("malformed auth challenge header: '%s', %d", challengeHeader, d)
+	var basic bool
+	for _, c := range challenges {
+		switch strings.ToLower(c.Scheme) {
+		case "bearer":
+			realm, ok := c.Params["realm"]
+			if !ok {
+				return nil, fmt.Errorf("missing realm in auth challenge header: '%s'", challengeHeader)
+			}
+			parsedRealm, err := url.Parse(realm)
+			if err != nil {
+				return nil, err
+			}
+			return &authService{
+				Realm:   parsedRealm,
+				Service: c.Params["service"],
+				Scope:   strings.Fields(c.Params["scope"]),
+			}, nil
+		case "basic":
+			basic = true
+		}
 	}
-	parts := strings.SplitN(strings.TrimSpace(match[0][1]), ",", 3)
-
-	var realm, service string
-	var scope []string
-	for _, s := range parts {
-		p := strings.SplitN(s, "=", 2)
-		if len(p) != 2 {
-			return nil, fmt.Errorf("malformed auth challenge header: '%s'", challengeHeader)
+
+	if basic {
+		return nil, ErrBasicAuth
+	}
+	return nil, fmt.Errorf("malformed auth challenge header: '%s', %d", challengeHeader, len(challenges))
+}
+
+// parseChallenges parses a WWW-Authenticate header with one or more challenges:
+//
+//	challenge  = auth-scheme [ 1*SP ( token68 / #auth-param ) ]
+//	auth-param = token BWS "=" BWS ( token / quoted-string )
+func parseChallenges(header string) ([]challenge, error) {
+	var challenges []challenge
+
+	p := &challengeParser{s: header}
+	for {
+		p.skip(" \t,")
+		if p.eof() {
+			break
 		}
-		key := p[0]
-		value := strings.TrimSuffix(strings.TrimPrefix(p[1], `"`), `"`)
-		switch key {
-		case "realm":
-			realm = value
-		case "service":
-			service = value
-		case "scope":
-			scope = strings.Fields(value)
-		default:
-			return nil, fmt.Errorf("unknown field in challege header %s: %v", key, challengeHeader)
+		scheme := p.token()
+		if scheme == "" {
+			return nil, fmt.Errorf("unexpected character %q at %d", p.s[p.i], p.i)
+		}
+		c := challenge{Scheme: scheme, Params: make(map[string]string)}
+		p.skip(" \t")
+		if err := p.params(c.Params); err != nil {
+			return nil, err
 		}
+		challenges = append(challenges, c)
 	}
-	parsedRealm, err := url.Parse(realm)
-	if err != nil {
-		return nil, err
+
+	if len(challenges) == 0 {
+		return nil, errors.New("no challenges")
 	}
+	return challenges, nil
+}
+
+type challengeParser struct {
+	s string
+	i int
+}
+
+func (p *challengeParser) eof() bool {
+	return p.i >= len(p.s)
+}
 
-	a := &authService{
-		Realm:   parsedRealm,
-		Service: service,
-		Scope:   scope,
+func (p *challengeParser) skip(chars string) {
+	for !p.eof() && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
 	}
+}
+
+func (p *challengeParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func isTokenChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
 
-	return a, nil
+func (p *challengeParser) token() string {
+	start := p.i
+	for !p.eof() && isTokenChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+func (p *challengeParser) quoted() (string, error) {
+	var b strings.Builder
+	for p.i++; !p.eof(); p.i++ {
+		switch c := p.s[p.i]; c {
+		case '"':
+			p.i++
+			return b.String(), nil
+		case '\\':
+			p.i++
+			if p.eof() {
+				return "", errors.New("unterminated quoted string")
+			}
+			b.WriteByte(p.s[p.i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted string")
+}
+
+// params parses the auth-params of a challenge stopping at the start of the next challenge
+func (p *challengeParser) params(params map[string]string) error {
+	for !p.eof() && p.peek() != ',' {
+		start := p.i
+		name := p.token()
+		p.skip(" \t")
+		if name == "" || p.peek() != '=' {
+			// The scheme of the next challenge
+			p.i = start
+			return nil
+		}
+		p.i++
+		p.skip(" \t")
+		if p.eof() || p.peek() == '=' || p.peek() == ',' {
+			// token68 like in "Negotiate abc=="
+			p.skip("=")
+			continue
+		}
+
+		var value string
+		if p.peek() == '"' {
+			var err error
+			if value, err = p.quoted(); err != nil {
+				return err
+			}
+		} else if value = p.token(); value == "" {
+			return fmt.Errorf("unexpected character %q at %d", p.s[p.i], p.i)
+		}
+		params[strings.ToLower(name)] = value
+
+		p.skip(" \t")
+		if p.peek() == ',' {
+			p.skip(" \t,")
+		} else if !p.eof() {
+			return fmt.Errorf("unexpected character %q at %d", p.s[p.i], p.i)
+		}
+	}
+	return nil
 }
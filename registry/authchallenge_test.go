@@ -1,6 +1,9 @@
 package registry
 
 import (
+	"net/http"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -18,7 +21,7 @@ type challengeTestCase struct {
 }
 
 func (asm authServiceMock) equalTo(v *authService) bool {
-	if asm.service != v.Service {
+	if asm.service != v.Service || len(asm.scope) != len(v.Scope) {
 		return false
 	}
 	for i, v := range v.Scope {
@@ -47,10 +50,52 @@ func TestParseChallenge(t *testing.T) {
 				scope:   []string{"repository:chrome:pull"},
 			},
 		},
+		{
+			header: `Bearer realm="https://r.j3ss.co/auth",service="Docker registry",scope="repository:chrome:pull registry:catalog:*"`,
+			value: authServiceMock{
+				service: "Docker registry",
+				realm:   "https://r.j3ss.co/auth",
+				scope:   []string{"repository:chrome:pull", "registry:catalog:*"},
+			},
+		},
+		{
+			header: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:foo:pull,push",error="insufficient_scope"`,
+			value: authServiceMock{
+				service: "registry.docker.io",
+				realm:   "https://auth.docker.io/token",
+				scope:   []string{"repository:foo:pull,push"},
+			},
+		},
+		{
+			header: `Basic realm="Registry Realm", Bearer realm = "https://r.j3ss.co/auth" , service="Docker \"registry\""`,
+			value: authServiceMock{
+				service: `Docker "registry"`,
+				realm:   "https://r.j3ss.co/auth",
+			},
+		},
+		{
+			header: `Negotiate abc==, bearer Realm="https://r.j3ss.co/auth", Service=registry`,
+			value: authServiceMock{
+				service: "registry",
+				realm:   "https://r.j3ss.co/auth",
+			},
+		},
 		{
 			header:      `Basic realm="https://r.j3ss.co/auth",service="Docker registry"`,
 			errorString: "basic auth required",
 		},
+		{
+			header:      `Bearer realm="https://r.j3ss.co/auth`,
+			errorString: "unterminated quoted string",
+		},
+		{
+			header:      `Bearer service="Docker registry"`,
+			errorString: "missing realm",
+		},
+		{
+			header:      ``,
+			errorString: "no challenges",
+		},
 		{
 			header:      `Basic realm="Registry Realm",service="Docker registry"`,
 			errorString: "basic auth required",
@@ -59,9 +104,12 @@ func TestParseChallenge(t *testing.T) {
 
 	for _, tc := range challengeHeaderCases {
 		val, err := parseChallenge(tc.header)
-		if err != nil && !strings.Contains(err.Error(), tc.errorString) {
+		if err != nil && (tc.errorString == "" || !strings.Contains(err.Error(), tc.errorString)) {
 			t.Fatalf("expected error to contain %v,  got %s", tc.errorString, err)
 		}
+		if err == nil && tc.errorString != "" {
+			t.Fatalf("expected error to contain %v, got none", tc.errorString)
+		}
 		if err == nil && !tc.value.equalTo(val) {
 			t.Fatalf("got %v, expected %v", val, tc.value)
 		}
@@ -91,3 +139,85 @@ func TestParseChallengePush(t *testing.T) {
 
 	}
 }
+
+func TestParseAuthHeaderMultiple(t *testing.T) {
+	header := http.Header{}
+	header.Add("www-authenticate", `Basic realm="Registry Realm"`)
+	header.Add("www-authenticate", `Bearer realm="https://r.j3ss.co/auth",service="Docker registry",scope="repository:a,b:pull"`)
+
+	val, err := parseAuthHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := authServiceMock{
+		service: "Docker registry",
+		realm:   "https://r.j3ss.co/auth",
+		scope:   []string{"repository:a,b:pull"},
+	}
+	if !want.equalTo(val) {
+		t.Fatalf("got %v, expected %v", val, want)
+	}
+}
+
+func TestAuthServiceRequestScopes(t *testing.T) {
+	val, err := parseChallenge(`Bearer realm="https://r.j3ss.co/auth?scope=x",service="Docker registry",scope="registry:catalog:* repository:foo:pull"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := val.Request("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := req.URL.Query()["scope"]
+	want := []string{"registry:catalog:*", "repository:foo:pull"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got scopes %v, expected %v", got, want)
+	}
+	if val.Realm.RawQuery != "scope=x" {
+		t.Fatalf("realm was modified: %v", val.Realm)
+	}
+}
+
+func FuzzParseChallenge(f *testing.F) {
+	for _, seed := range []string{
+		`Bearer realm="https://foobar.com/api/v1/token",service=foobar.com,scope=""`,
+		`Bearer realm="https://foo.com/v2/token",service="foo.com",scope="repository:pdr/tls:pull,push"`,
+		`Basic realm="Registry Realm", Bearer realm="a", error="insufficient_scope"`,
+		`Negotiate abc==, Bearer realm="a\"b"`,
+		`Bearer realm="`,
+		``,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, header string) {
+		val, err := parseChallenge(header)
+		if err == nil && val.Realm == nil {
+			t.Fatalf("%q: got nil realm", header)
+		}
+	})
+}
+
+// quote returns s as a quoted-string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func FuzzParseChallengeQuoted(f *testing.F) {
+	f.Add("https://r.j3ss.co/auth", "Docker registry", "repository:foo:pull,push")
+	f.Add("https://r.j3ss.co/auth", `Docker "registry"`, "")
+	f.Fuzz(func(t *testing.T, realm, service, scope string) {
+		u, err := url.Parse(realm)
+		if err != nil {
+			t.Skip()
+		}
+		header := "Basic realm=" + quote(realm) + ", Bearer realm=" + quote(realm) + ",service=" + quote(service) + ",scope=" + quote(scope) + `,error="insufficient_scope"`
+		val, err := parseChallenge(header)
+		if err != nil {
+			t.Fatalf("%q: %v", header, err)
+		}
+		want := authServiceMock{realm: u.String(), service: service, scope: strings.Fields(scope)}
+		if !want.equalTo(val) {
+			t.Fatalf("%q: got %v, expected %v", header, val, want)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"slices"
+
+	"github.com/ricardobranco777/regview/oci"
+)
+
+// Backend is where images are read from: a registry or a local image store
+type Backend interface {
+	Catalog(ctx context.Context, u string) ([]string, error)
+	Tags(ctx context.Context, repo string) ([]string, error)
+	GetInfoAll(ctx context.Context, repo string, ref string, arches []string, oses []string) ([]*Info, error)
+	GetImage(ctx context.Context, repo string, ref string) (*oci.Image, error)
+	GetManifest(ctx context.Context, repo string, ref string) (*Manifest, error)
+	GetBlob(ctx context.Context, repo string, digest string) (io.ReadCloser, error)
+}
+
+// SkipPlatform returns true for the manifests in an index not matching the architectures & OSes if any,
+// and for those with an unknown platform like attestations
+func SkipPlatform(p *oci.Platform, arches []string, oses []string) bool {
+	if p == nil {
+		return len(arches) > 0 || len(oses) > 0
+	}
+	return len(arches) > 0 && !slices.Contains(arches, p.Architecture) || p.Architecture == "unknown" ||
+		len(oses) > 0 && !slices.Contains(oses, p.OS) || p.OS == "unknown"
+}
+
+// AttestationDigests maps the digests of the platform manifests in the index to those of their attestation manifests
+func AttestationDigests(index *oci.Index) map[string]string {
+	attestations := make(map[string]string)
+	for _, manifest := range index.Manifests {
+		if manifest.Annotations[annotationReferenceType] == attestationManifest {
+			attestations[manifest.Annotations[annotationReferenceDigest]] = manifest.Digest.String()
+		}
+	}
+	return attestations
+}
+
+var _ Backend = (*Registry)(nil)
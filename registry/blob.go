@@ -0,0 +1,21 @@
+package registry
+
+import (
+	"context"
+	"io"
+)
+
+// GetBlob returns a reader for the blob.  The caller must close it
+func (r *Registry) GetBlob(ctx context.Context, repo string, digest string) (io.ReadCloser, error) {
+	url := r.url("/v2/%s/blobs/%s", repo, digest)
+	resp, err := r.httpGet(ctx, url, nil)
+	if resp == nil {
+		return nil, err
+	}
+	if err != nil {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, apiError(data, err)
+	}
+	return resp.Body, nil
+}
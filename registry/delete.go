@@ -12,10 +12,12 @@ import (
 func (r *Registry) Delete(ctx context.Context, repository string, ref string) (err error) {
 	url := r.url("/v2/%s/manifests/%s", repository, ref)
 	resp, err := r.httpDelete(ctx, url, nil)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNotFound {
 		return nil
@@ -0,0 +1,35 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	types "github.com/moby/moby/api/types/registry"
+)
+
+func TestDeleteReleasesSlot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`))
+	}))
+	defer ts.Close()
+
+	r, err := New(context.Background(), types.AuthConfig{ServerAddress: ts.URL}, Opt{Insecure: true, Jobs: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Failed deletes must not keep their slots
+	for range 3 {
+		if err := r.Delete(ctx, "repo", "latest"); err == nil {
+			t.Fatal("expected error")
+		} else if ctx.Err() != nil {
+			t.Fatal(err)
+		}
+	}
+}
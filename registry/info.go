@@ -3,10 +3,9 @@ package registry
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"slices"
 	"strings"
 	"sync"
 
@@ -19,14 +18,19 @@ import (
 
 // Info type for interesting information
 type Info struct {
-	Image     *oci.Image
-	Platform  *oci.Platform
-	Digest    string
-	DigestAll string
-	ID        string
-	Repo      string
-	Ref       string
-	Size      int64
+	Image        *oci.Image
+	Platform     *oci.Platform
+	Digest       string
+	DigestAll    string
+	ID           string
+	Repo         string
+	Ref          string
+	Size         int64
+	Layers       []oci.Descriptor
+	Attestation  string           // Digest of the BuildKit attestation manifest, if any
+	Attestations []Attestation    // Set by the caller
+	Referrers    []oci.Descriptor // Set by the caller
+	Signature    string           // Set by the caller
 }
 
 // GetImage gets the image config
@@ -71,17 +75,18 @@ func (r *Registry) getDigest(ctx context.Context, repo string, ref string, data
 	return digest.FromBytes(data)
 }
 
-// Get Info from manifest
-func (r *Registry) getInfo(ctx context.Context, m *oci.Manifest, header http.Header, repo string, ref string) (*Info, error) {
+// NewInfo returns the info from the manifest.  The digest is set only if the reference is one
+func NewInfo(m *oci.Manifest, repo string, ref string) (*Info, error) {
 	if m.Versioned.SchemaVersion != 2 {
 		err := errors.New("invalid schema version")
 		return nil, err
 	}
 
 	info := &Info{
-		Repo: repo,
-		Ref:  ref,
-		ID:   m.Config.Digest.String(),
+		Repo:   repo,
+		Ref:    ref,
+		ID:     m.Config.Digest.String(),
+		Layers: m.Layers,
 	}
 
 	for _, layer := range m.Layers {
@@ -90,7 +95,19 @@ func (r *Registry) getInfo(ctx context.Context, m *oci.Manifest, header http.Hea
 
 	if strings.Contains(ref, ":") {
 		info.Digest = ref
-	} else {
+	}
+
+	return info, nil
+}
+
+// Get Info from manifest
+func (r *Registry) getInfo(ctx context.Context, m *oci.Manifest, header http.Header, repo string, ref string) (*Info, error) {
+	info, err := NewInfo(m, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Digest == "" {
 		d, _ := digest.Parse(header.Get("Docker-Content-Digest"))
 		info.Digest = d.String()
 	}
@@ -133,16 +150,11 @@ func (r *Registry) GetInfo(ctx context.Context, repo string, ref string) (*Info,
 	return info, nil
 }
 
-// GetInfoAll from fat manifests and then each manifest
+// GetInfoAll from fat manifests and then each manifest.
+// On partial failure it returns the infos for the manifests it could get along with the errors.
 func (r *Registry) GetInfoAll(ctx context.Context, repo string, ref string, arches []string, oses []string) ([]*Info, error) {
 	url := r.url("/v2/%s/manifests/%s", repo, ref)
-	headers := []*header{
-		{"Accept", manifestlist.MediaTypeManifestList},
-		{"Accept", oci.MediaTypeImageIndex},
-		{"Accept", schema2.MediaTypeManifest},
-		{"Accept", oci.MediaTypeImageManifest},
-	}
-	resp, err := r.httpGet(ctx, url, headers)
+	resp, err := r.httpGet(ctx, url, manifestHeaders)
 	if resp == nil {
 		return nil, err
 	}
@@ -180,10 +192,13 @@ func (r *Registry) GetInfoAll(ctx context.Context, repo string, ref string, arch
 	var wg sync.WaitGroup
 	var l sync.Mutex
 
+	// Attestation manifests reference the platform manifest they're for
+	attestations := AttestationDigests(&m)
+
 	var infos []*Info
+	var errs []error
 	for _, manifest := range m.Manifests {
-		if len(arches) > 0 && !slices.Contains(arches, manifest.Platform.Architecture) || manifest.Platform.Architecture == "unknown" ||
-			len(oses) > 0 && !slices.Contains(oses, manifest.Platform.OS) || manifest.Platform.OS == "unknown" {
+		if SkipPlatform(manifest.Platform, arches, oses) {
 			continue
 		}
 		// Avoid address being captured in for loop
@@ -192,19 +207,21 @@ func (r *Registry) GetInfoAll(ctx context.Context, repo string, ref string, arch
 		go func(manifest *oci.Descriptor) {
 			defer wg.Done()
 			info, err := r.GetInfo(ctx, repo, manifest.Digest.String())
+			l.Lock()
+			defer l.Unlock()
 			if err != nil {
-				log.Printf("%s@%s: %v", repo, manifest.Digest.String(), err)
+				errs = append(errs, fmt.Errorf("%s@%s: %w", repo, manifest.Digest.String(), err))
 				return
 			}
 			info.Platform = manifest.Platform
 			info.DigestAll = d.String()
+			info.Attestation = attestations[manifest.Digest.String()]
 			info.Ref = ref
-			l.Lock()
 			infos = append(infos, info)
-			l.Unlock()
 		}(&manifest)
 	}
 	wg.Wait()
 
-	return infos, nil
+	// Return the infos we got along with the errors for the manifests we didn't
+	return infos, errors.Join(errs...)
 }
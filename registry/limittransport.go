@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LimitTransport limits the number of concurrent requests and the rate of requests per host.
+// A request counts against the limit until its response body is read or closed.
+type LimitTransport struct {
+	Transport http.RoundTripper
+	Jobs      int     // Maximum number of concurrent requests. Unlimited if zero
+	Rate      float64 // Maximum number of requests per second per host. Unlimited if zero
+
+	once sync.Once
+	sem  chan struct{}
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// RoundTrip defines the round tripper for the limit transport.
+func (t *LimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.once.Do(func() {
+		if t.Jobs > 0 {
+			t.sem = make(chan struct{}, t.Jobs)
+		}
+		t.next = make(map[string]time.Time)
+	})
+
+	ctx := req.Context()
+	if err := t.wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+	if err := t.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		t.release()
+		return resp, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, release: sync.OnceFunc(t.release)}
+
+	return resp, nil
+}
+
+func (t *LimitTransport) acquire(ctx context.Context) error {
+	if t.sem == nil {
+		return nil
+	}
+	select {
+	case t.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *LimitTransport) release() {
+	if t.sem != nil {
+		<-t.sem
+	}
+}
+
+// wait spaces requests to the same host according to the rate
+func (t *LimitTransport) wait(ctx context.Context, host string) error {
+	if t.Rate <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / t.Rate)
+
+	t.mu.Lock()
+	now := time.Now()
+	at := t.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	t.next[host] = at.Add(interval)
+	t.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	return sleep(ctx, delay)
+}
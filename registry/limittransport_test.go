@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimitTransportJobs(t *testing.T) {
+	var inflight, maxInflight atomic.Int32
+	transport := &LimitTransport{
+		Jobs: 3,
+		Transport: testTransport(func(req *http.Request) (*http.Response, error) {
+			n := inflight.Add(1)
+			for {
+				m := maxInflight.Load()
+				if n <= m || maxInflight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("data")),
+			}, nil
+		}),
+	}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// The slot is released when the body is read
+			inflight.Add(-1)
+			io.ReadAll(resp.Body)
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInflight.Load(); got != 3 {
+		t.Errorf("got %d concurrent requests; want 3", got)
+	}
+	if got := len(transport.sem); got != 0 {
+		t.Errorf("got %d requests holding a slot; want 0", got)
+	}
+}
+
+func TestLimitTransportRate(t *testing.T) {
+	transport := &LimitTransport{
+		Rate: 100,
+		Transport: testTransport(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}
+
+	start := time.Now()
+	for _, host := range []string{"a", "b", "a", "b", "a", "a"} {
+		if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 4 requests to the same host take at least 3 intervals
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("requests took %v; want at least 30ms", elapsed)
+	}
+}
@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/distribution/distribution/manifest/manifestlist"
+	"github.com/distribution/distribution/manifest/schema2"
+	"github.com/ricardobranco777/regview/oci"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Accept headers for indexes & manifests
+var manifestHeaders = []*header{
+	{"Accept", manifestlist.MediaTypeManifestList},
+	{"Accept", oci.MediaTypeImageIndex},
+	{"Accept", schema2.MediaTypeManifest},
+	{"Accept", oci.MediaTypeImageManifest},
+}
+
+// Manifest holds the raw manifest as returned by the registry
+type Manifest struct {
+	MediaType string
+	Digest    string
+	Data      []byte
+}
+
+// IsIndex returns true for manifest lists & indexes
+func (m *Manifest) IsIndex() bool {
+	return m.MediaType == manifestlist.MediaTypeManifestList || m.MediaType == oci.MediaTypeImageIndex
+}
+
+// Children returns the digests of the manifests in an index
+func (m *Manifest) Children() ([]string, error) {
+	if !m.IsIndex() {
+		return nil, nil
+	}
+
+	var index oci.Index
+	if err := index.UnmarshalJSON(m.Data); err != nil {
+		return nil, err
+	}
+
+	var digests []string
+	for _, manifest := range index.Manifests {
+		digests = append(digests, manifest.Digest.String())
+	}
+	return digests, nil
+}
+
+// Blobs returns the digests of the config & layers of an image manifest.
+// Foreign layers with URLs are skipped as they're not in the registry
+func (m *Manifest) Blobs() ([]string, error) {
+	if m.IsIndex() {
+		return nil, nil
+	}
+
+	var manifest oci.Manifest
+	if err := manifest.UnmarshalJSON(m.Data); err != nil {
+		return nil, err
+	}
+
+	digests := []string{manifest.Config.Digest.String()}
+	for _, layer := range manifest.Layers {
+		if len(layer.URLs) == 0 {
+			digests = append(digests, layer.Digest.String())
+		}
+	}
+	return digests, nil
+}
+
+// GetManifest gets the raw index or manifest
+func (r *Registry) GetManifest(ctx context.Context, repo string, ref string) (*Manifest, error) {
+	url := r.url("/v2/%s/manifests/%s", repo, ref)
+	resp, err := r.httpGet(ctx, url, manifestHeaders)
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if err := apiError(data, err); err != nil {
+		return nil, err
+	}
+
+	// The digest of the raw bytes is the canonical one
+	d, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		d = digest.FromBytes(data)
+	}
+
+	return &Manifest{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    d.String(),
+		Data:      data,
+	}, nil
+}
+
+// ManifestDigest returns the digest of the index or manifest using HEAD if the registry supports it
+func (r *Registry) ManifestDigest(ctx context.Context, repo string, ref string) (string, error) {
+	url := r.url("/v2/%s/manifests/%s", repo, ref)
+	h, err := r.httpHead(ctx, url, manifestHeaders)
+	if err != nil {
+		return "", err
+	}
+	if d, err := digest.Parse(h.Get("Docker-Content-Digest")); err == nil {
+		return d.String(), nil
+	}
+
+	m, err := r.GetManifest(ctx, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return m.Digest, nil
+}
+
+// PutManifest uploads an index or manifest.  The reference may be a tag or a digest.
+// It returns the digest of the manifest.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pushing-manifests
+func (r *Registry) PutManifest(ctx context.Context, repo string, ref string, mediaType string, data []byte) (string, error) {
+	url := r.url("/v2/%s/manifests/%s", repo, ref)
+	headers := []*header{{"Content-Type", mediaType}}
+	resp, err := r.httpPut(ctx, url, headers, data)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err := checkStatus(resp, err, http.StatusCreated); err != nil {
+		return "", err
+	}
+
+	d, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		d = digest.FromBytes(data)
+	}
+	return d.String(), nil
+}
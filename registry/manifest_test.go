@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+
+	types "github.com/moby/moby/api/types/registry"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// manifestServer is a registry storing manifests that requires a bearer token
+func manifestServer() *httptest.Server {
+	var mu sync.Mutex
+	manifests := make(map[string][]byte)
+	mediaTypes := make(map[string]string)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.Write([]byte(`{"token":"abcdef1234"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abcdef1234" {
+			w.Header().Set("www-authenticate", `Bearer realm="`+ts.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ref := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			d := digest.FromBytes(data).String()
+			if strings.HasPrefix(ref, "sha256:") && ref != d {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":[{"code":"DIGEST_INVALID"}]}`))
+				return
+			}
+			manifests[ref], manifests[d] = data, data
+			mediaTypes[ref], mediaTypes[d] = r.Header.Get("Content-Type"), r.Header.Get("Content-Type")
+			w.Header().Set("Docker-Content-Digest", d)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			data, ok := manifests[ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`))
+				return
+			}
+			w.Header().Set("Content-Type", mediaTypes[ref])
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+			w.Write(data)
+		}
+	}))
+	return ts
+}
+
+func TestPutManifest(t *testing.T) {
+	ts := manifestServer()
+	defer ts.Close()
+
+	ctx := context.Background()
+	r, err := New(ctx, types.AuthConfig{ServerAddress: ts.URL}, Opt{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:` + strings.Repeat("a", 64) + `","size":1}]}`)
+	want := digest.FromBytes(data).String()
+
+	// The first request gets a 401 so the body must be sent again
+	got, err := r.PutManifest(ctx, "repo", "latest", oci.MediaTypeImageIndex, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got digest %s; want %s", got, want)
+	}
+
+	m, err := r.GetManifest(ctx, "repo", "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Digest != want || m.MediaType != oci.MediaTypeImageIndex || !bytes.Equal(m.Data, data) {
+		t.Errorf("got %+v", m)
+	}
+	children, err := m.Children()
+	if err != nil || len(children) != 1 || children[0] != "sha256:"+strings.Repeat("a", 64) {
+		t.Errorf("got children %v, %v", children, err)
+	}
+
+	if _, err := r.PutManifest(ctx, "repo", "sha256:"+strings.Repeat("0", 64), oci.MediaTypeImageIndex, data); err == nil || err.Error() != "DIGEST_INVALID" {
+		t.Errorf("expected DIGEST_INVALID, got %v", err)
+	}
+	if _, err := r.GetManifest(ctx, "repo", "missing"); err == nil || err.Error() != "MANIFEST_UNKNOWN" {
+		t.Errorf("expected MANIFEST_UNKNOWN, got %v", err)
+	}
+}
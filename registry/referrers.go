@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/peterhellberg/link"
+	"github.com/ricardobranco777/regview/oci"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Referrers returns the descriptors of the manifests referring to the digest, like signatures, SBOMs & attestations.
+// Registries without the referrers API are queried using the tag schema.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers
+func (r *Registry) Referrers(ctx context.Context, repo string, d string, artifactType string) ([]oci.Descriptor, error) {
+	u := r.url("/v2/%s/referrers/%s", repo, d)
+	if artifactType != "" {
+		u += "?artifactType=" + url.QueryEscape(artifactType)
+	}
+
+	var descriptors []oci.Descriptor
+	for page := 0; u != ""; page++ {
+		resp, err := r.httpGet(ctx, u, []*header{{"Accept", oci.MediaTypeImageIndex}})
+		if resp == nil {
+			return nil, err
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if page == 0 && resp.StatusCode == http.StatusNotFound {
+			return r.referrersTag(ctx, repo, d, artifactType)
+		}
+		if err := apiError(data, err); err != nil {
+			return nil, err
+		}
+
+		var index oci.Index
+		if err := index.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(resp.Header.Get("OCI-Filters-Applied"), "artifactType") {
+			index.Manifests = filterArtifactType(index.Manifests, artifactType)
+		}
+		descriptors = append(descriptors, index.Manifests...)
+
+		u = ""
+		for _, l := range link.ParseHeader(resp.Header) {
+			if l.Rel == "next" {
+				unescaped, _ := url.QueryUnescape(l.URI)
+				u = r.url("%s", unescaped)
+			}
+		}
+	}
+
+	return descriptors, nil
+}
+
+// referrersTag gets the referrers from the index tagged with the digest like sha256-<hex>
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#referrers-tag-schema
+func (r *Registry) referrersTag(ctx context.Context, repo string, d string, artifactType string) ([]oci.Descriptor, error) {
+	dgst, err := digest.Parse(d)
+	if err != nil {
+		return nil, err
+	}
+
+	url := r.url("/v2/%s/manifests/%s-%s", repo, dgst.Algorithm(), dgst.Encoded())
+	resp, err := r.httpGet(ctx, url, []*header{{"Accept", oci.MediaTypeImageIndex}})
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if err := apiError(data, err); err != nil {
+		return nil, err
+	}
+
+	var index oci.Index
+	if err := index.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return filterArtifactType(index.Manifests, artifactType), nil
+}
+
+func filterArtifactType(descriptors []oci.Descriptor, artifactType string) []oci.Descriptor {
+	if artifactType == "" {
+		return descriptors
+	}
+	var filtered []oci.Descriptor
+	for _, d := range descriptors {
+		if d.ArtifactType == artifactType {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	types "github.com/moby/moby/api/types/registry"
+)
+
+const (
+	subject = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	sig     = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	sbom    = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func referrersIndex(digests ...string) string {
+	var manifests []string
+	for _, d := range digests {
+		artifactType := "application/vnd.dev.cosign.artifact.sig.v1+json"
+		if d == sbom {
+			artifactType = "application/spdx+json"
+		}
+		manifests = append(manifests, fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"%s","size":1,"artifactType":"%s"}`, d, artifactType))
+	}
+	return `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` + strings.Join(manifests, ",") + `]}`
+}
+
+func TestReferrers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		// Referrers API with pagination
+		case "/v2/api/referrers/" + subject:
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", `</v2/api/referrers/`+subject+`?page=2>; rel="next"`)
+				w.Write([]byte(referrersIndex(sig)))
+			} else {
+				w.Write([]byte(referrersIndex(sbom)))
+			}
+		// Tag schema
+		case "/v2/tag/manifests/sha256-" + strings.TrimPrefix(subject, "sha256:"):
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			w.Write([]byte(referrersIndex(sig, sbom)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	r, err := New(ctx, types.AuthConfig{ServerAddress: ts.URL}, Opt{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		repo         string
+		artifactType string
+		want         []string
+	}{
+		{repo: "api", want: []string{sig, sbom}},
+		{repo: "api", artifactType: "application/spdx+json", want: []string{sbom}},
+		{repo: "tag", want: []string{sig, sbom}},
+		{repo: "tag", artifactType: "application/spdx+json", want: []string{sbom}},
+		{repo: "none"},
+	} {
+		referrers, err := r.Referrers(ctx, tc.repo, subject, tc.artifactType)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.repo, err)
+		}
+		var got []string
+		for _, d := range referrers {
+			got = append(got, d.Digest.String())
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("%s %s: got %v; want %v", tc.repo, tc.artifactType, got, tc.want)
+		}
+	}
+}
@@ -40,6 +40,9 @@ type Opt struct {
 	NonSSL     bool
 	Timeout    time.Duration
 	Headers    map[string]string
+	Jobs       int     // Maximum number of concurrent requests
+	Rate       float64 // Maximum number of requests per second per host
+	Retries    int     // Maximum number of retries for failed idempotent requests
 }
 
 // New creates a new Registry struct with the given URL and credentials.
@@ -85,10 +88,18 @@ func newFromTransport(ctx context.Context, auth types.AuthConfig, transport http
 		}
 	}
 
-	tokenTransport := &TokenTransport{
+	// Limit every request including those to the token server
+	limitTransport := &LimitTransport{
 		Transport: transport,
-		Username:  auth.Username,
-		Password:  auth.Password,
+		Jobs:      opt.Jobs,
+		Rate:      opt.Rate,
+	}
+	tokenTransport := &TokenTransport{
+		Transport:     limitTransport,
+		Username:      auth.Username,
+		Password:      auth.Password,
+		IdentityToken: auth.IdentityToken,
+		RegistryToken: auth.RegistryToken,
 	}
 	basicAuthTransport := &BasicTransport{
 		Transport: tokenTransport,
@@ -96,8 +107,12 @@ func newFromTransport(ctx context.Context, auth types.AuthConfig, transport http
 		Username:  auth.Username,
 		Password:  auth.Password,
 	}
+	retryTransport := &RetryTransport{
+		Transport:   basicAuthTransport,
+		MaxAttempts: opt.Retries + 1,
+	}
 	errorTransport := &ErrorTransport{
-		Transport: basicAuthTransport,
+		Transport: retryTransport,
 	}
 	customTransport := &CustomTransport{
 		Transport: errorTransport,
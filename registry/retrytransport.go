@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMinDelay = 500 * time.Millisecond
+	defaultMaxDelay = time.Minute
+)
+
+// RetryTransport retries idempotent requests on network errors, 429 & 5xx responses
+// using exponential backoff with jitter unless the server tells us how long to wait.
+type RetryTransport struct {
+	Transport   http.RoundTripper
+	MaxAttempts int           // Maximum number of attempts including the first one
+	MinDelay    time.Duration // Delay before the first retry
+	MaxDelay    time.Duration // We don't retry if the server asks us to wait longer than this
+}
+
+// RoundTrip defines the round tripper for the retry transport.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.MaxAttempts <= 1 || !isIdempotent(req) {
+		return t.Transport.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.Transport.RoundTrip(req)
+		if attempt >= t.MaxAttempts || !shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp.Header); ok {
+				if d > t.maxDelay() {
+					return resp, err
+				}
+				delay = d
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		if req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+func (t *RetryTransport) maxDelay() time.Duration {
+	if t.MaxDelay > 0 {
+		return t.MaxDelay
+	}
+	return defaultMaxDelay
+}
+
+// backoff returns the exponential delay for the attempt with equal jitter
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.MinDelay
+	if delay <= 0 {
+		delay = defaultMinDelay
+	}
+	for i := 1; i < attempt && delay < t.maxDelay(); i++ {
+		delay *= 2
+	}
+	delay = min(delay, t.maxDelay())
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isIdempotent returns true for idempotent requests that can be sent again
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the server with Retry-After or the RateLimit headers used by Docker Hub.
+// https://docs.docker.com/docker-hub/usage/pulls/#view-pull-rate-and-limit
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if t, err := http.ParseTime(value); err == nil {
+			return max(time.Until(t), 0), true
+		}
+	}
+
+	if value := header.Get("RateLimit-Reset"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	// Docker Hub sends "RateLimit-Remaining: 0;w=21600" with the window in seconds
+	remaining, window, _ := strings.Cut(header.Get("RateLimit-Remaining"), ";w=")
+	if remaining == "0" {
+		if seconds, err := strconv.Atoi(window); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
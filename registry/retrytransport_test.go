@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	for _, tc := range []struct {
+		method   string
+		statuses []int
+		header   http.Header
+		attempts int
+		status   int
+	}{
+		{http.MethodGet, []int{503, 502, 200}, nil, 3, 200},
+		{http.MethodGet, []int{429, 200}, http.Header{"Retry-After": {"0"}}, 2, 200},
+		{http.MethodGet, []int{500, 500, 500, 500, 500}, nil, 4, 500},
+		{http.MethodGet, []int{404}, nil, 1, 404},
+		{http.MethodGet, []int{501}, nil, 1, 501},
+		{http.MethodPost, []int{503, 200}, nil, 1, 503},
+		{http.MethodPut, []int{503, 200}, nil, 2, 200},
+		{http.MethodGet, []int{429, 200}, http.Header{"Retry-After": {"3600"}}, 1, 429},
+		{http.MethodGet, []int{429, 200}, http.Header{"Ratelimit-Remaining": {"0;w=21600"}}, 1, 429},
+	} {
+		var attempts int
+		transport := &RetryTransport{
+			MaxAttempts: 4,
+			MinDelay:    time.Millisecond,
+			Transport: testTransport(func(req *http.Request) (*http.Response, error) {
+				if req.Body != nil {
+					if body, _ := io.ReadAll(req.Body); string(body) != "data" {
+						t.Errorf("got body %q on attempt %d", body, attempts)
+					}
+				}
+				status := tc.statuses[attempts]
+				attempts++
+				return &http.Response{StatusCode: status, Header: tc.header, Body: http.NoBody}, nil
+			}),
+		}
+
+		req, _ := http.NewRequest(tc.method, "http://localhost/", nil)
+		if tc.method == http.MethodPut || tc.method == http.MethodPost {
+			req, _ = http.NewRequest(tc.method, "http://localhost/", bytes.NewReader([]byte("data")))
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.status || attempts != tc.attempts {
+			t.Errorf("%s %v: got status %d after %d attempts; want %d after %d", tc.method, tc.statuses, resp.StatusCode, attempts, tc.status, tc.attempts)
+		}
+	}
+}
+
+func TestRetryTransportNetworkError(t *testing.T) {
+	var attempts int
+	transport := &RetryTransport{
+		MaxAttempts: 3,
+		MinDelay:    time.Millisecond,
+		Transport: testTransport(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return nil, errors.New("connection reset by peer")
+		}),
+	}
+	if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+		t.Fatal("expected error")
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts; want 3", attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		header http.Header
+		delay  time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": {"120"}}, 2 * time.Minute, true},
+		{http.Header{"Retry-After": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}, 0, true},
+		{http.Header{"Ratelimit-Reset": {"30"}}, 30 * time.Second, true},
+		{http.Header{"Ratelimit-Remaining": {"0;w=21600"}}, 6 * time.Hour, true},
+		{http.Header{"Ratelimit-Remaining": {"10;w=21600"}}, 0, false},
+		{http.Header{"Retry-After": {"soon"}}, 0, false},
+		{http.Header{}, 0, false},
+	} {
+		delay, ok := retryAfter(tc.header)
+		if delay != tc.delay || ok != tc.ok {
+			t.Errorf("retryAfter(%v) got %v, %v; want %v, %v", tc.header, delay, ok, tc.delay, tc.ok)
+		}
+	}
+}
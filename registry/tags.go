@@ -18,7 +18,7 @@ func (r *Registry) tags(ctx context.Context, u string, repository string) ([]str
 	}
 
 	resp, err := r.httpGet(ctx, uri, nil)
-	if err != nil {
+	if resp == nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
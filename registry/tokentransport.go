@@ -10,17 +10,55 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Tokens without expires_in are valid for 60 seconds according to the spec
+const (
+	defaultTokenLifetime = 60 * time.Second
+	tokenLeeway          = 5 * time.Second
+)
+
+var reRepoPath = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs|tags|referrers)/`)
+
 // TokenTransport defines the data structure for authentication via tokens.
+// Tokens are cached by realm, service & scope so it's safe to share it between goroutines.
 type TokenTransport struct {
-	Transport http.RoundTripper
-	Username  string
-	Password  string
+	Transport     http.RoundTripper
+	Username      string
+	Password      string
+	IdentityToken string // OAuth2 refresh token
+	RegistryToken string // Bearer token sent as is
+
+	mu     sync.Mutex
+	tokens map[string]*cachedToken
+	realms map[string]*authService // Last challenge seen for each host
+}
+
+type cachedToken struct {
+	sync.Mutex
+	token   string
+	expires time.Time
 }
 
 // RoundTrip defines the round tripper for token transport.
 func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.RegistryToken != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.RegistryToken))
+		return t.Transport.RoundTrip(req)
+	}
+
+	token := t.cached(req)
+	if token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
 	resp, err := t.Transport.RoundTrip(req)
 	if err != nil {
 		return resp, err
@@ -38,12 +76,107 @@ func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	resp.Body.Close()
 
-	return t.authAndRetry(authService, req)
+	t.remember(req.URL.Host, authService)
+	for _, scope := range requestScopes(req) {
+		if !slices.Contains(authService.Scope, scope) {
+			authService.Scope = append(authService.Scope, scope)
+		}
+	}
+
+	return t.authAndRetry(authService, req, token)
+}
+
+// remember saves the realm & service of the challenge to reuse cached tokens in later requests
+func (t *TokenTransport) remember(host string, a *authService) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.realms == nil {
+		t.realms = make(map[string]*authService)
+	}
+	t.realms[host] = &authService{Realm: a.Realm, Service: a.Service}
+}
+
+// cached returns a valid cached token for the scope the request will most likely be challenged with
+func (t *TokenTransport) cached(req *http.Request) string {
+	scopes := requestScopes(req)
+	if len(scopes) == 0 {
+		return ""
+	}
+
+	t.mu.Lock()
+	realm, ok := t.realms[req.URL.Host]
+	t.mu.Unlock()
+	if !ok {
+		return ""
+	}
+
+	a := &authService{Realm: realm.Realm, Service: realm.Service, Scope: scopes}
+	entry := t.entry(a.key())
+	entry.Lock()
+	defer entry.Unlock()
+	if time.Now().Before(entry.expires) {
+		return entry.token
+	}
+	return ""
+}
+
+func (t *TokenTransport) entry(key string) *cachedToken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens == nil {
+		t.tokens = make(map[string]*cachedToken)
+	}
+	entry, ok := t.tokens[key]
+	if !ok {
+		entry = &cachedToken{}
+		t.tokens[key] = entry
+	}
+	return entry
+}
+
+type scopesKey struct{}
+
+// withScopes returns a context for requests needing more scopes than the one for the repository,
+// like "repository:other:pull" to mount blobs from another repository
+func withScopes(ctx context.Context, scopes ...string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// requestScopes returns the scopes needed for a request
+func requestScopes(req *http.Request) []string {
+	var scopes []string
+	if scope := requestScope(req); scope != "" {
+		scopes = append(scopes, scope)
+	}
+	if extra, ok := req.Context().Value(scopesKey{}).([]string); ok {
+		scopes = append(scopes, extra...)
+	}
+	return scopes
+}
+
+// requestScope returns the scope needed for a request to the registry API
+func requestScope(req *http.Request) string {
+	if req.URL.Path == "/v2/_catalog" {
+		return "registry:catalog:*"
+	}
+	m := reRepoPath.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		return ""
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return "repository:" + m[1] + ":pull"
+	case http.MethodDelete:
+		return "repository:" + m[1] + ":delete"
+	}
+	return "repository:" + m[1] + ":pull,push"
 }
 
 type authToken struct {
 	Token       string `json:"token"`
 	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
 }
 
 func (t authToken) String() (string, error) {
@@ -56,9 +189,22 @@ func (t authToken) String() (string, error) {
 	return "", errors.New("auth token cannot be empty")
 }
 
-func (t *TokenTransport) authAndRetry(authService *authService, req *http.Request) (*http.Response, error) {
-	token, authResp, err := t.auth(req.Context(), authService)
+// expiry returns the time the token should be renewed
+func (t authToken) expiry() time.Time {
+	issuedAt, err := time.Parse(time.RFC3339, t.IssuedAt)
 	if err != nil {
+		issuedAt = time.Now()
+	}
+	lifetime := time.Duration(t.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+	return issuedAt.Add(lifetime - tokenLeeway)
+}
+
+func (t *TokenTransport) authAndRetry(authService *authService, req *http.Request, stale string) (*http.Response, error) {
+	token, authResp, err := t.token(req.Context(), authService, stale)
+	if err != nil || token == "" {
 		return authResp, err
 	}
 
@@ -69,37 +215,102 @@ func (t *TokenTransport) authAndRetry(authService *authService, req *http.Reques
 	return response, err
 }
 
-func (t *TokenTransport) auth(ctx context.Context, authService *authService) (string, *http.Response, error) {
+// token returns a cached token for the auth service unless it's expired or stale.
+// Concurrent requests for the same token wait for the first one to get it.
+func (t *TokenTransport) token(ctx context.Context, authService *authService, stale string) (string, *http.Response, error) {
+	entry := t.entry(authService.key())
+	entry.Lock()
+	defer entry.Unlock()
+
+	if entry.token != "" && entry.token != stale && time.Now().Before(entry.expires) {
+		return entry.token, nil, nil
+	}
+
+	token, expires, resp, err := t.auth(ctx, authService)
+	if err != nil || token == "" {
+		return "", resp, err
+	}
+	entry.token, entry.expires = token, expires
+
+	return token, nil, nil
+}
+
+// auth gets a token using the OAuth2 refresh token if we have one or basic auth otherwise.
+// https://distribution.github.io/distribution/spec/auth/oauth/
+func (t *TokenTransport) auth(ctx context.Context, authService *authService) (string, time.Time, *http.Response, error) {
+	if t.IdentityToken != "" {
+		authReq, err := authService.OAuthRequest(url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {t.IdentityToken},
+		})
+		if err != nil {
+			return "", time.Time{}, nil, err
+		}
+		return t.fetchToken(ctx, authReq)
+	}
+
 	authReq, err := authService.Request(t.Username, t.Password)
 	if err != nil {
-		return "", nil, err
+		return "", time.Time{}, nil, err
+	}
+	token, expires, resp, err := t.fetchToken(ctx, authReq)
+
+	// Some token servers only implement the OAuth2 password grant
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed) && t.Username != "" && t.Password != "" {
+		authReq, err := authService.OAuthRequest(url.Values{
+			"grant_type": {"password"},
+			"username":   {t.Username},
+			"password":   {t.Password},
+		})
+		if err != nil {
+			return "", time.Time{}, nil, err
+		}
+		return t.fetchToken(ctx, authReq)
 	}
 
+	return token, expires, resp, err
+}
+
+func (t *TokenTransport) fetchToken(ctx context.Context, authReq *http.Request) (string, time.Time, *http.Response, error) {
+	var expires time.Time
+
 	c := http.Client{
 		Transport: t.Transport,
 	}
 
 	resp, err := c.Do(authReq.WithContext(ctx))
 	if err != nil {
-		return "", nil, err
+		return "", expires, nil, err
 	}
 	defer resp.Body.Close()
 	dump(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return "", resp, err
+		return "", expires, resp, err
 	}
 
 	var authToken authToken
 	if err := json.NewDecoder(resp.Body).Decode(&authToken); err != nil {
-		return "", nil, err
+		return "", expires, nil, err
 	}
 
 	token, err := authToken.String()
-	return token, nil, err
+	return token, authToken.expiry(), nil, err
 }
 
 func (t *TokenTransport) retry(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	// The body was consumed by the first request
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("cannot retry request with body")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	return t.Transport.RoundTrip(req)
 }
@@ -110,16 +321,24 @@ type authService struct {
 	Scope   []string
 }
 
+// key returns the key used to cache tokens for this auth service
+func (a *authService) key() string {
+	scope := slices.Clone(a.Scope)
+	slices.Sort(scope)
+	return a.Realm.String() + " " + a.Service + " " + strings.Join(slices.Compact(scope), " ")
+}
+
 func (a *authService) Request(username, password string) (*http.Request, error) {
-	q := a.Realm.Query()
+	realm := *a.Realm
+	q := realm.Query()
 	q.Set("service", a.Service)
+	q.Del("scope")
 	for _, s := range a.Scope {
-		q.Set("scope", s)
+		q.Add("scope", s)
 	}
-	//	q.Set("scope", "repository:r.j3ss.co/htop:push,pull")
-	a.Realm.RawQuery = q.Encode()
+	realm.RawQuery = q.Encode()
 
-	req, err := http.NewRequest("GET", a.Realm.String(), nil)
+	req, err := http.NewRequest("GET", realm.String(), nil)
 
 	if username != "" || password != "" {
 		req.SetBasicAuth(username, password)
@@ -128,6 +347,23 @@ func (a *authService) Request(username, password string) (*http.Request, error)
 	return req, err
 }
 
+// OAuthRequest returns a POST request for the OAuth2 grant in the form
+func (a *authService) OAuthRequest(form url.Values) (*http.Request, error) {
+	form.Set("service", a.Service)
+	form.Set("client_id", "regview")
+	if len(a.Scope) > 0 {
+		form.Set("scope", strings.Join(a.Scope, " "))
+	}
+
+	req, err := http.NewRequest("POST", a.Realm.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req, nil
+}
+
 func isTokenDemand(resp *http.Response) (*authService, error) {
 	if resp == nil {
 		return nil, nil
@@ -3,10 +3,14 @@ package registry
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	types "github.com/moby/moby/api/types/registry"
 )
@@ -193,3 +197,132 @@ func TestTokenTransportAuthLeak(t *testing.T) {
 		t.Fatal("Expected body to be closed")
 	}
 }
+
+func TestTokenTransportCache(t *testing.T) {
+	var authCalls, apiCalls atomic.Int32
+	var expiresIn int
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			authCalls.Add(1)
+			issuedAt := time.Now().Add(-time.Hour).Format(time.RFC3339)
+			fmt.Fprintf(w, `{"token":"%s","expires_in":%d,"issued_at":"%s"}`, r.URL.Query().Get("scope"), expiresIn, issuedAt)
+			return
+		}
+		apiCalls.Add(1)
+		scope := "repository:" + strings.Split(r.URL.Path, "/")[2] + ":pull"
+		if r.Header.Get("Authorization") != "Bearer "+scope {
+			w.Header().Set("www-authenticate", `Bearer realm="`+ts.URL+`/token",service="test",scope="`+scope+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		expiresIn int
+		authCalls int32
+		apiCalls  int32
+	}{
+		{7200, 2, 2 + 20},
+		{60, 20, 2 * 20},
+	} {
+		expiresIn = tc.expiresIn
+		authCalls.Store(0)
+		apiCalls.Store(0)
+		client := &http.Client{Transport: &TokenTransport{Transport: http.DefaultTransport}}
+
+		var wg sync.WaitGroup
+		for i := range 20 {
+			repo := []string{"foo", "bar"}[i%2]
+			if i < 2 {
+				// Warm up the cache
+				resp, err := client.Get(ts.URL + "/v2/" + repo + "/manifests/latest")
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(ts.URL + "/v2/" + repo + "/manifests/latest")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("unexpected status code: %d", resp.StatusCode)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := authCalls.Load(); got != tc.authCalls {
+			t.Errorf("expires_in=%d: got %d auth requests; want %d", tc.expiresIn, got, tc.authCalls)
+		}
+		if got := apiCalls.Load(); got != tc.apiCalls {
+			t.Errorf("expires_in=%d: got %d API requests; want %d", tc.expiresIn, got, tc.apiCalls)
+		}
+	}
+}
+
+func TestTokenTransportOAuth(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			r.ParseForm()
+			if r.Form.Get("service") != "test" || r.Form.Get("scope") != "repository:foo:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			switch r.Form.Get("grant_type") {
+			case "refresh_token":
+				fmt.Fprintf(w, `{"access_token":"refresh-%s"}`, r.Form.Get("refresh_token"))
+			case "password":
+				fmt.Fprintf(w, `{"access_token":"password-%s-%s"}`, r.Form.Get("username"), r.Form.Get("password"))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			return
+		}
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			w.Header().Set("X-Token", strings.TrimPrefix(auth, "Bearer "))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("www-authenticate", `Bearer realm="`+ts.URL+`/token",service="test",scope="repository:foo:pull"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		auth  types.AuthConfig
+		token string
+	}{
+		{types.AuthConfig{IdentityToken: "abc"}, "refresh-abc"},
+		{types.AuthConfig{Username: "user", Password: "pass"}, "password-user-pass"},
+		{types.AuthConfig{Username: "user", RegistryToken: "xyz"}, "xyz"},
+	} {
+		tc.auth.ServerAddress = ts.URL
+		r, err := New(context.Background(), tc.auth, Opt{Insecure: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := r.httpGet(context.Background(), ts.URL+"/v2/foo/manifests/latest", nil)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.auth, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Token"); got != tc.token {
+			t.Errorf("%+v: got token %q; want %q", tc.auth, got, tc.token)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// DefaultChunkSize is the size of the chunks used by UploadBlobChunked
+const DefaultChunkSize = 16 << 20
+
+// checkStatus returns the API error if any or an error if the status code is not the expected one
+func checkStatus(resp *http.Response, err error, status int) error {
+	if resp == nil {
+		return err
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if err := apiError(data, err); err != nil {
+		return err
+	}
+	if resp.StatusCode != status {
+		return fmt.Errorf("got status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// location returns the absolute upload URL in the Location header
+func location(resp *http.Response) (*url.URL, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, errors.New("missing Location header")
+	}
+	return resp.Request.URL.Parse(loc)
+}
+
+// BlobExists checks if the blob exists in the repository
+func (r *Registry) BlobExists(ctx context.Context, repo string, digest string) (bool, error) {
+	url := r.url("/v2/%s/blobs/%s", repo, digest)
+	resp, err := r.httpMethod(ctx, url, nil, http.MethodHead)
+	if resp == nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, err
+}
+
+// startUpload starts an upload session returning its location
+func (r *Registry) startUpload(ctx context.Context, repo string) (*url.URL, error) {
+	url := r.url("/v2/%s/blobs/uploads/", repo)
+	resp, err := r.httpRequest(ctx, url, nil, http.MethodPost, nil)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err := checkStatus(resp, err, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return location(resp)
+}
+
+// finishUpload completes the upload session with the last chunk, if any
+func (r *Registry) finishUpload(ctx context.Context, loc *url.URL, digest string, data []byte) error {
+	query := loc.Query()
+	query.Set("digest", digest)
+	loc.RawQuery = query.Encode()
+
+	headers := []*header{{"Content-Type", "application/octet-stream"}}
+	resp, err := r.httpPut(ctx, loc.String(), headers, data)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	return checkStatus(resp, err, http.StatusCreated)
+}
+
+// UploadBlob uploads the blob in a single request.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pushing-a-blob-monolithically
+func (r *Registry) UploadBlob(ctx context.Context, repo string, digest string, data []byte) error {
+	loc, err := r.startUpload(ctx, repo)
+	if err != nil {
+		return err
+	}
+	return r.finishUpload(ctx, loc, digest, data)
+}
+
+// UploadBlobChunked uploads the blob read from rd in chunks of chunkSize bytes.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pushing-a-blob-in-chunks
+func (r *Registry) UploadBlobChunked(ctx context.Context, repo string, digest string, rd io.Reader, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	loc, err := r.startUpload(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(rd, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Send the last chunk with the PUT
+			return r.finishUpload(ctx, loc, digest, buf[:n])
+		} else if err != nil {
+			return err
+		}
+
+		if loc, err = r.uploadChunk(ctx, loc, buf[:n], offset); err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+}
+
+// uploadChunk sends the chunk returning the location for the next one
+func (r *Registry) uploadChunk(ctx context.Context, loc *url.URL, chunk []byte, offset int64) (*url.URL, error) {
+	headers := []*header{
+		{"Content-Type", "application/octet-stream"},
+		{"Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1)},
+	}
+	resp, err := r.httpRequest(ctx, loc.String(), headers, http.MethodPatch, bytes.NewReader(chunk))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err := checkStatus(resp, err, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return location(resp)
+}
+
+// MountBlob mounts a blob from another repository in the same registry.
+// It returns false if the registry didn't mount it so it must be uploaded.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#mounting-a-blob-from-another-repository
+func (r *Registry) MountBlob(ctx context.Context, repo string, digest string, from string) (bool, error) {
+	url := r.url("/v2/%s/blobs/uploads/?mount=%s&from=%s", repo, url.QueryEscape(digest), url.QueryEscape(from))
+	ctx = withScopes(ctx, "repository:"+from+":pull")
+	resp, err := r.httpRequest(ctx, url, nil, http.MethodPost, nil)
+	if resp == nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		// The registry started an upload session instead.  Cancel it after
+		// releasing the slot held by this response so the DELETE can get one
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if loc, err := location(resp); err == nil {
+			if resp, _ := r.httpDelete(ctx, loc.String(), nil); resp != nil {
+				resp.Body.Close()
+			}
+		}
+		return false, nil
+	}
+	if err := checkStatus(resp, err, http.StatusCreated); err != nil {
+		return false, err
+	}
+	return true, nil
+}
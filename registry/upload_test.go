@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	types "github.com/moby/moby/api/types/registry"
+	digest "github.com/opencontainers/go-digest"
+)
+
+var reUpload = regexp.MustCompile(`^/v2/(.+)/blobs/(uploads/([0-9]*)|sha256:[0-9a-f]+)$`)
+
+// blobServer is a registry storing blobs that requires a bearer token with the right scopes
+type blobServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	blobs    map[string][]byte // repo@digest
+	uploads  [][]byte
+	scopes   []string // Scopes requested to the token server
+	patches  int
+	badPatch bool // Reject PATCH requests
+}
+
+func newBlobServer() *blobServer {
+	s := &blobServer{blobs: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *blobServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		s.scopes = append(s.scopes, r.URL.Query()["scope"]...)
+		w.Write([]byte(`{"token":"` + strings.Join(r.URL.Query()["scope"], " ") + `"}`))
+		return
+	}
+
+	m := reUpload.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	repo := m[1]
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !strings.Contains(token, "repository:"+repo+":") {
+		w.Header().Set("www-authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull,push"`, s.URL, repo))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+		if _, ok := s.blobs[repo+"@"+m[2]]; ok {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost:
+		if from := r.URL.Query().Get("from"); from != "" {
+			d := r.URL.Query().Get("mount")
+			if data, ok := s.blobs[from+"@"+d]; ok && strings.Contains(token, "repository:"+from+":pull") {
+				s.blobs[repo+"@"+d] = data
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		s.uploads = append(s.uploads, nil)
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", repo, len(s.uploads)-1))
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPatch || r.Method == http.MethodPut:
+		var id int
+		fmt.Sscan(m[3], &id)
+		data, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPatch {
+			s.patches++
+			if s.badPatch || r.Header.Get("Content-Range") != fmt.Sprintf("%d-%d", len(s.uploads[id]), len(s.uploads[id])+len(data)-1) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				w.Write([]byte(`{"errors":[{"code":"BLOB_UPLOAD_INVALID"}]}`))
+				return
+			}
+		}
+		s.uploads[id] = append(s.uploads[id], data...)
+		if r.Method == http.MethodPatch {
+			w.Header().Set("Location", r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		d := r.URL.Query().Get("digest")
+		if digest.FromBytes(s.uploads[id]).String() != d {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"code":"DIGEST_INVALID"}]}`))
+			return
+		}
+		s.blobs[repo+"@"+d] = s.uploads[id]
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestUploadBlob(t *testing.T) {
+	s := newBlobServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	r, err := New(ctx, types.AuthConfig{ServerAddress: s.URL}, Opt{Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := []byte("hello world")
+	big := bytes.Repeat([]byte("0123456789"), 100)
+	for _, tc := range []struct {
+		data    []byte
+		chunked bool
+		patches int
+	}{
+		{data: small},
+		{data: big, chunked: true, patches: 3},
+		{data: small, chunked: true},
+	} {
+		d := digest.FromBytes(tc.data).String()
+		s.patches = 0
+		if tc.chunked {
+			err = r.UploadBlobChunked(ctx, "repo", d, bytes.NewReader(tc.data), 300)
+		} else {
+			err = r.UploadBlob(ctx, "repo", d, tc.data)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s.blobs["repo@"+d], tc.data) {
+			t.Errorf("blob %s not uploaded", d)
+		}
+		if s.patches != tc.patches {
+			t.Errorf("got %d PATCH requests; want %d", s.patches, tc.patches)
+		}
+		if ok, err := r.BlobExists(ctx, "repo", d); !ok || err != nil {
+			t.Errorf("BlobExists(%s) got %v, %v", d, ok, err)
+		}
+	}
+
+	// The error details of a failed chunk are kept
+	s.badPatch = true
+	if err := r.UploadBlobChunked(ctx, "repo", digest.FromBytes(big).String(), bytes.NewReader(big), 300); err == nil || err.Error() != "BLOB_UPLOAD_INVALID" {
+		t.Errorf("expected BLOB_UPLOAD_INVALID, got %v", err)
+	}
+	s.badPatch = false
+
+	d := digest.FromBytes(small).String()
+	if err := r.UploadBlob(ctx, "repo", digest.FromString("other").String(), small); err == nil || err.Error() != "DIGEST_INVALID" {
+		t.Errorf("expected DIGEST_INVALID, got %v", err)
+	}
+	if ok, err := r.BlobExists(ctx, "other", d); ok || err != nil {
+		t.Errorf("BlobExists got %v, %v", ok, err)
+	}
+
+	// Mounting needs pull access to the source repository
+	if ok, err := r.MountBlob(ctx, "other", d, "repo"); !ok || err != nil {
+		t.Errorf("MountBlob got %v, %v", ok, err)
+	}
+	if !slices.Contains(s.scopes, "repository:repo:pull") {
+		t.Errorf("token for the source repository not requested: %v", s.scopes)
+	}
+	if ok, err := r.MountBlob(ctx, "other", digest.FromString("missing").String(), "repo"); ok || err != nil {
+		t.Errorf("MountBlob got %v, %v", ok, err)
+	}
+}
+
+func TestMountBlobReleasesSlot(t *testing.T) {
+	var deletes int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deletes++
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Location", "/v2/other/blobs/uploads/0")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"upload":"started"}`))
+	}))
+	defer ts.Close()
+
+	r, err := New(context.Background(), types.AuthConfig{ServerAddress: ts.URL}, Opt{Insecure: true, Jobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Cancelling the upload session needs the slot of the mount request
+	if ok, err := r.MountBlob(ctx, "other", digest.FromString("blob").String(), "repo"); ok || err != nil {
+		t.Errorf("MountBlob got %v, %v", ok, err)
+	}
+	if deletes != 1 {
+		t.Errorf("got %d DELETE requests; want 1", deletes)
+	}
+}
@@ -1,8 +1,10 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net/http"
 )
 
@@ -13,6 +15,9 @@ type header struct {
 
 func (r *Registry) httpHead(ctx context.Context, url string, headers []*header) (http.Header, error) {
 	resp, err := r.httpMethod(ctx, url, headers, http.MethodHead)
+	if resp != nil {
+		resp.Body.Close()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -27,8 +32,17 @@ func (r *Registry) httpDelete(ctx context.Context, url string, headers []*header
 	return r.httpMethod(ctx, url, headers, http.MethodDelete)
 }
 
+func (r *Registry) httpPut(ctx context.Context, url string, headers []*header, body []byte) (*http.Response, error) {
+	return r.httpRequest(ctx, url, headers, http.MethodPut, bytes.NewReader(body))
+}
+
 func (r *Registry) httpMethod(ctx context.Context, url string, headers []*header, method string) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, nil)
+	return r.httpRequest(ctx, url, headers, method, nil)
+}
+
+// httpRequest sends the request.  The body must be a *bytes.Reader or similar so it can be sent again on retries
+func (r *Registry) httpRequest(ctx context.Context, url string, headers []*header, method string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
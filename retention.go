@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ricardobranco777/regview/registry"
+
+	concurrently "github.com/tejzpr/ordered-concurrently/v3"
+)
+
+var protectRegexes []*regexp.Regexp
+
+// tagInfo holds what the retention policy needs to know about a tag
+type tagInfo struct {
+	tag     string
+	digest  string   // Digest of the index or manifest the tag points to
+	digests []string // Digest & the digests of the manifests in the index
+	created *time.Time
+	blobs   map[string]int64 // Sizes of the manifests & blobs of every platform by digest
+}
+
+// deletion is a digest to be deleted along with the tags pointing to it.
+// The blobs are those not referenced by the kept tags
+type deletion struct {
+	digest string
+	tags   []string
+	blobs  map[string]int64
+	size   int64
+}
+
+type prunePlan struct {
+	repo      string
+	deletions []*deletion
+}
+
+type pruneWorker struct {
+	reg  *registry.Registry
+	repo string
+}
+
+func (w *pruneWorker) Run(ctx context.Context) any {
+	plan := &prunePlan{repo: w.repo}
+
+	tags, err := w.reg.Tags(ctx, w.repo)
+	if err != nil {
+		logError(ctx, "%s: %v\n", w.repo, err)
+		return plan
+	}
+	tags = filterRegex(tags, ignoreTags, true)
+
+	var infos []*tagInfo
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	for _, tag := range tags {
+		wg.Add(1)
+		go func(tag string) {
+			defer wg.Done()
+			info, err := getTagInfo(ctx, w.reg, w.repo, tag)
+			if err != nil {
+				logError(ctx, "%s:%s: %v\n", w.repo, tag, err)
+				return
+			}
+			m.Lock()
+			infos = append(infos, info)
+			m.Unlock()
+		}(tag)
+	}
+	wg.Wait()
+
+	// Don't delete anything if we don't know about every tag that may be protecting a digest
+	if len(infos) != len(tags) {
+		logError(ctx, "%s: skipping repository as some tags could not be inspected\n", w.repo)
+		return plan
+	}
+
+	plan.deletions = applyPolicy(w.repo, infos, time.Now())
+	return plan
+}
+
+func getTagInfo(ctx context.Context, r *registry.Registry, repo string, tag string) (*tagInfo, error) {
+	infos, err := r.GetInfoAll(ctx, repo, tag, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("no manifests found")
+	}
+
+	info := &tagInfo{tag: tag, digest: infos[0].DigestAll}
+	if info.digest == "" {
+		info.digest = infos[0].Digest
+	}
+	if info.digest == "" {
+		return nil, fmt.Errorf("unknown digest")
+	}
+	info.digests = append(info.digests, info.digest)
+	for _, i := range infos {
+		info.digests = append(info.digests, i.Digest)
+	}
+
+	// Layers shared between platforms are counted once
+	info.blobs = make(map[string]int64)
+	if err := addBlobs(ctx, r, repo, info.digest, nil, nil, info.blobs); err != nil {
+		return nil, err
+	}
+
+	if opts.keep > 0 || opts.olderThan > 0 {
+		image, err := r.GetImage(ctx, repo, infos[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		info.created = image.Created
+	}
+
+	return info, nil
+}
+
+// isProtected returns true for tags that don't match the tag pattern or match a --protect pattern
+func isProtected(tag string) bool {
+	if tagRegex != nil && !tagRegex.MatchString(tag) {
+		return true
+	}
+	for _, regex := range protectRegexes {
+		if regex.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPolicy returns the digests to delete.  Digests referenced by kept tags are never deleted
+func applyPolicy(repo string, infos []*tagInfo, now time.Time) []*deletion {
+	var candidates, kept []*tagInfo
+	for _, info := range infos {
+		if isProtected(info.tag) {
+			kept = append(kept, info)
+		} else {
+			candidates = append(candidates, info)
+		}
+	}
+
+	if opts.keep > 0 || opts.olderThan > 0 {
+		// Tags without creation date are kept as we can't tell their age
+		var dated []*tagInfo
+		for _, info := range candidates {
+			if info.created == nil {
+				kept = append(kept, info)
+			} else {
+				dated = append(dated, info)
+			}
+		}
+		// Newest first
+		sort.SliceStable(dated, func(i, j int) bool {
+			return dated[i].created.After(*dated[j].created)
+		})
+		candidates = nil
+		for i, info := range dated {
+			if i < opts.keep || opts.olderThan > 0 && now.Sub(*info.created) < opts.olderThan {
+				kept = append(kept, info)
+			} else {
+				candidates = append(candidates, info)
+			}
+		}
+	}
+
+	keptDigests := make(map[string]string)
+	keptBlobs := make(map[string]bool)
+	for _, info := range kept {
+		for _, digest := range info.digests {
+			keptDigests[digest] = info.tag
+		}
+		for digest := range info.blobs {
+			keptBlobs[digest] = true
+		}
+	}
+
+	var deletions []*deletion
+	byDigest := make(map[string]*deletion)
+	for _, info := range candidates {
+		if tag, ok := keptDigests[info.digest]; ok {
+			fmt.Fprintf(os.Stderr, "WARNING: %s:%s: not deleting %s referenced by %s:%s\n", repo, info.tag, info.digest, repo, tag)
+			continue
+		}
+		if d, ok := byDigest[info.digest]; ok {
+			d.tags = append(d.tags, info.tag)
+			continue
+		}
+		d := &deletion{digest: info.digest, tags: []string{info.tag}, blobs: make(map[string]int64)}
+		for digest, size := range info.blobs {
+			if !keptBlobs[digest] {
+				d.blobs[digest] = size
+			}
+		}
+		d.size, _ = sumSizes(d.blobs, nil)
+		byDigest[info.digest] = d
+		deletions = append(deletions, d)
+	}
+
+	return deletions
+}
+
+// pruneAll deletes the tags matching the patterns according to the retention policy
+func pruneAll(ctx context.Context, domain string) {
+	r, err := createRegistryClient(ctx, domain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repos, err := r.Catalog(ctx, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	repos = filterRegex(repos, repoRegex, false)
+	sort.Strings(repos)
+
+	inputChan := make(chan concurrently.WorkFunction)
+	output := concurrently.Process(ctx, inputChan, &concurrently.Options{PoolSize: opts.jobs, OutChannelBuffer: opts.jobs})
+
+	go func() {
+		defer close(inputChan)
+		for _, repo := range repos {
+			select {
+			case inputChan <- &pruneWorker{reg: r, repo: repo}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var count int
+	// Blobs shared by the deleted images are counted once
+	reclaimed := make(map[string]int64)
+	for out := range output {
+		plan := out.Value.(*prunePlan)
+		for _, d := range plan.deletions {
+			if ctx.Err() != nil {
+				break
+			}
+			tags := strings.Join(d.tags, ",")
+			fmt.Printf("Deleting %s:%s (%s, %s)\n", plan.repo, tags, d.digest, prettySize(d.size))
+			if !opts.dryRun {
+				if !deleteRef(ctx, r, plan.repo, d.digest, "", d.tags) {
+					continue
+				}
+			}
+			count += len(d.tags)
+			maps.Copy(reclaimed, d.blobs)
+		}
+	}
+	size, _ := sumSizes(reclaimed, nil)
+
+	verb := "Deleted"
+	if opts.dryRun {
+		verb = "Would delete"
+	}
+	fmt.Printf("%s %d tags reclaiming up to %s\n", verb, count, prettySize(size))
+}
+
+// checkPrunePolicy refuses to delete every image in the registry by accident
+func checkPrunePolicy(repoPattern string, tagPattern string) {
+	if repoPattern == "" && tagPattern == "" && opts.keep == 0 && opts.olderThan == 0 {
+		log.Fatal("Refusing to delete every image. Specify a pattern, --keep or --older-than")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func Test_applyPolicy(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	days := func(n int) *time.Time {
+		t := now.Add(-time.Duration(n) * 24 * time.Hour)
+		return &t
+	}
+	// Every image shares the base layer
+	blobs := func(sizes map[string]int64) map[string]int64 {
+		sizes["sha256:base"] = 1000
+		return sizes
+	}
+	infos := []*tagInfo{
+		{tag: "1.0", digest: "sha256:10", digests: []string{"sha256:10", "sha256:10a"}, created: days(100), blobs: blobs(map[string]int64{"sha256:10": 1, "sha256:10a": 16})},
+		{tag: "1.1", digest: "sha256:11", digests: []string{"sha256:11"}, created: days(60), blobs: blobs(map[string]int64{"sha256:11": 2})},
+		{tag: "stable", digest: "sha256:11", digests: []string{"sha256:11"}, created: days(60), blobs: blobs(map[string]int64{"sha256:11": 2})},
+		{tag: "1.2", digest: "sha256:12", digests: []string{"sha256:12"}, created: days(40), blobs: blobs(map[string]int64{"sha256:12": 4})},
+		{tag: "1.2.0", digest: "sha256:12", digests: []string{"sha256:12"}, created: days(40), blobs: blobs(map[string]int64{"sha256:12": 4})},
+		{tag: "1.3", digest: "sha256:13", digests: []string{"sha256:13"}, created: days(1), blobs: blobs(map[string]int64{"sha256:13": 8})},
+		{tag: "amd64", digest: "sha256:10a", digests: []string{"sha256:10a"}, created: days(100), blobs: blobs(map[string]int64{"sha256:10a": 16})},
+		{tag: "nodate", digest: "sha256:99", digests: []string{"sha256:99"}, blobs: blobs(map[string]int64{"sha256:99": 32})},
+	}
+
+	defer func() {
+		opts.keep, opts.olderThan, tagRegex, protectRegexes = 0, 0, nil, nil
+	}()
+
+	for _, tc := range []struct {
+		keep      int
+		olderThan time.Duration
+		tag       string
+		protect   string
+		want      []*deletion
+	}{
+		{
+			keep:    1,
+			protect: "^stable$",
+			want: []*deletion{
+				{digest: "sha256:12", tags: []string{"1.2", "1.2.0"}, blobs: map[string]int64{"sha256:12": 4}, size: 4},
+				{digest: "sha256:10", tags: []string{"1.0"}, blobs: map[string]int64{"sha256:10": 1, "sha256:10a": 16}, size: 17},
+				{digest: "sha256:10a", tags: []string{"amd64"}, blobs: map[string]int64{"sha256:10a": 16}, size: 16},
+			},
+		},
+		{
+			olderThan: 50 * 24 * time.Hour,
+			tag:       `^1\.`,
+			want: []*deletion{
+				{digest: "sha256:10", tags: []string{"1.0"}, blobs: map[string]int64{"sha256:10": 1}, size: 1},
+			},
+		},
+		{
+			keep:      3,
+			olderThan: 30 * 24 * time.Hour,
+			tag:       `^1\.`,
+			want: []*deletion{
+				{digest: "sha256:10", tags: []string{"1.0"}, blobs: map[string]int64{"sha256:10": 1}, size: 1},
+			},
+		},
+		{
+			tag: `^(1\.3|amd64)$`,
+			want: []*deletion{
+				{digest: "sha256:13", tags: []string{"1.3"}, blobs: map[string]int64{"sha256:13": 8}, size: 8},
+			},
+		},
+	} {
+		opts.keep, opts.olderThan = tc.keep, tc.olderThan
+		tagRegex, protectRegexes = nil, nil
+		if tc.tag != "" {
+			tagRegex = regexp.MustCompile(tc.tag)
+		}
+		if tc.protect != "" {
+			protectRegexes = []*regexp.Regexp{regexp.MustCompile(tc.protect)}
+		}
+		got := applyPolicy("repo", infos, now)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("keep=%d older-than=%v tag=%q protect=%q", tc.keep, tc.olderThan, tc.tag, tc.protect)
+			for _, d := range got {
+				t.Errorf("got %+v", d)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ricardobranco777/regview/registry"
+)
+
+// syncState records the digest of each synced tag so re-runs only copy the tags that changed
+type syncState struct {
+	Source      string            `json:"source"`
+	Destination string            `json:"destination"`
+	Tags        map[string]string `json:"tags"` // Source repo:tag to digest
+}
+
+var reUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// syncStatePath returns the default state file for the source & destination
+func syncStatePath(src string, dst string) string {
+	name := reUnsafe.ReplaceAllString(src+"_"+dst, "_")
+	return filepath.Join(stateDir(), "sync", name+".json")
+}
+
+func loadSyncState(path string, src string, dst string) (*syncState, error) {
+	state := &syncState{Source: src, Destination: dst, Tags: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if state.Source != src || state.Destination != dst {
+		return nil, fmt.Errorf("%s: state file is for syncing %s to %s", path, state.Source, state.Destination)
+	}
+	if state.Tags == nil {
+		state.Tags = make(map[string]string)
+	}
+	return state, nil
+}
+
+// save writes the state atomically
+func (s *syncState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// stale returns the synced tags that are in scope but no longer in the source, sorted
+func (s *syncState) stale(seen map[string]bool) []string {
+	var tags []string
+	for key := range s.Tags {
+		repo, tag, _ := strings.Cut(key, ":")
+		if seen[key] || repoRegex != nil && !repoRegex.MatchString(repo) || tagRegex != nil && !tagRegex.MatchString(tag) {
+			continue
+		}
+		tags = append(tags, key)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// syncImages mirrors the repositories matching SRC to DST copying only the tags that changed since the last run
+func syncImages(ctx context.Context, src string, dst string) {
+	srcDomain, srcPath, err := parseImageArg(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dstDomain, dstPath, err := parseImageArg(dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if strings.ContainsAny(dstPath, ":@") {
+		log.Fatalf("%s: the destination must be a registry with an optional repository prefix\n", dst)
+	}
+	prefix := strings.TrimSuffix(dstPath, "/")
+
+	if srcPath != "" {
+		v := strings.SplitN(srcPath, ":", 2)
+		if repoRegex, err = globRegex(v[0]); err != nil {
+			log.Fatal(err)
+		}
+		if len(v) > 1 {
+			if tagRegex, err = globRegex(v[1]); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	statePath := opts.state
+	if statePath == "" {
+		statePath = syncStatePath(src, dst)
+	}
+	state, err := loadSyncState(statePath, src, dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srcReg, err := createRegistryClient(ctx, srcDomain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dstReg, err := newRegistryClient(ctx, dstDomain, opts.destUsername, opts.destPassword)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	jobs, listErr := listCopyJobs(ctx, srcReg, prefix)
+	if listErr != nil {
+		logErrors(ctx, "", listErr)
+	}
+
+	var synced, current, pruned, failed int
+	seen := make(map[string]bool)
+	c := newCopier(srcReg, dstReg)
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		key := job.srcRepo + ":" + job.srcRef
+		seen[key] = true
+
+		digest, err := srcReg.ManifestDigest(ctx, job.srcRepo, job.srcRef)
+		if err != nil {
+			logError(ctx, "%s/%s: %v\n", srcDomain, key, err)
+			failed++
+			continue
+		}
+		if state.Tags[key] == digest {
+			current++
+			continue
+		}
+
+		fmt.Printf("Syncing %s/%s to %s/%s:%s\n", srcDomain, key, dstDomain, job.dstRepo, job.dstRef)
+		if opts.dryRun {
+			synced++
+			continue
+		}
+		if _, err := c.copyManifest(ctx, job.srcRepo, digest, job.dstRepo, job.dstRef); err != nil {
+			logError(ctx, "%s/%s: %v\n", srcDomain, key, err)
+			failed++
+			continue
+		}
+		synced++
+		state.Tags[key] = digest
+		if err := state.save(statePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if opts.prune && ctx.Err() == nil {
+		if listErr != nil || failed > 0 {
+			log.Print("Not pruning as the source couldn't be synced completely")
+		} else {
+			pruned = pruneSynced(ctx, dstReg, state, state.stale(seen), prefix)
+			if !opts.dryRun {
+				if err := state.save(statePath); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Synced %d tags, %d up to date, %d pruned\n", synced, current, pruned)
+}
+
+// pruneSynced deletes from the destination the synced tags that vanished from the source.
+// Digests still referenced by other tags in the destination repository are kept unless --force is used.
+// Stale tags sharing a digest don't keep each other as they're all being pruned
+func pruneSynced(ctx context.Context, r *registry.Registry, state *syncState, stale []string, prefix string) int {
+	destRepo := func(key string) (string, string) {
+		repo, tag, _ := strings.Cut(key, ":")
+		if prefix != "" {
+			repo = prefix + "/" + repo
+		}
+		return repo, tag
+	}
+	staleTags := make(map[string][]string)
+	for _, key := range stale {
+		repo, tag := destRepo(key)
+		staleTags[repo] = append(staleTags[repo], tag)
+	}
+
+	var pruned int
+	refs := make(map[string][]*tagRef)
+	for _, key := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+		repo, tag := destRepo(key)
+		digest := state.Tags[key]
+
+		if _, ok := refs[repo]; !ok {
+			tagRefs, err := getTagRefs(ctx, r, repo)
+			if err != nil {
+				logError(ctx, "%s: %v\n", repo, err)
+				continue
+			}
+			refs[repo] = slices.DeleteFunc(tagRefs, func(ref *tagRef) bool {
+				return slices.Contains(staleTags[repo], ref.tag)
+			})
+		}
+		if collateral := findCollateral(tag, []string{digest}, refs[repo]); len(collateral) > 0 && !opts.force {
+			for _, c := range collateral {
+				fmt.Fprintf(os.Stderr, "WARNING: %s:%s: not pruning as %s\n", repo, tag, c)
+			}
+			continue
+		}
+
+		fmt.Printf("Pruning %s:%s (%s)\n", repo, tag, digest)
+		if !opts.dryRun {
+			if !deleteRef(ctx, r, repo, digest, "", []string{tag}) {
+				continue
+			}
+			delete(state.Tags, key)
+		}
+		pruned++
+	}
+	return pruned
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+)
+
+func Test_syncImages(t *testing.T) {
+	src, dst := newFakeRegistry(), newFakeRegistry()
+	defer src.Close()
+	defer dst.Close()
+	ctx := context.Background()
+
+	saved := opts
+	defer func() {
+		opts = saved
+		repoRegex, tagRegex = nil, nil
+	}()
+	opts.insecure = true
+	opts.journal = ""
+	opts.state = filepath.Join(t.TempDir(), "state.json")
+
+	srcHost := strings.TrimPrefix(src.URL, "http://")
+	dstHost := strings.TrimPrefix(dst.URL, "http://")
+
+	a := pushImage(src, "a", "1.0")
+	b := pushImage(src, "b", "2.0")
+	syncImages(ctx, srcHost, dstHost+"/mirror")
+
+	state, err := loadSyncState(opts.state, srcHost, dstHost+"/mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a:1.0": a, "b:2.0": b}; !reflect.DeepEqual(state.Tags, want) {
+		t.Errorf("got state %v; want %v", state.Tags, want)
+	}
+	for _, key := range []string{"mirror/a:1.0", "mirror/b:2.0"} {
+		if _, ok := dst.manifests[key]; !ok {
+			t.Errorf("%s not synced", key)
+		}
+	}
+
+	// Nothing changed
+	puts := dst.puts
+	syncImages(ctx, srcHost, dstHost+"/mirror")
+	if dst.puts != puts {
+		t.Errorf("got %d manifests PUT; want none", dst.puts-puts)
+	}
+
+	// b vanished from the source
+	delete(src.manifests, "b:2.0")
+	opts.prune = true
+	syncImages(ctx, srcHost, dstHost+"/mirror")
+	if _, ok := dst.manifests["mirror/b:"+b]; ok {
+		t.Error("mirror/b:2.0 not pruned")
+	}
+	if _, ok := dst.manifests["mirror/a:"+a]; !ok {
+		t.Error("mirror/a:1.0 pruned")
+	}
+	if state, _ = loadSyncState(opts.state, srcHost, dstHost+"/mirror"); !reflect.DeepEqual(state.Tags, map[string]string{"a:1.0": a}) {
+		t.Errorf("got state %v", state.Tags)
+	}
+
+	if _, err := loadSyncState(opts.state, srcHost, "other"); err == nil {
+		t.Error("expected error loading the state for another destination")
+	}
+}
+
+func Test_pruneSynced(t *testing.T) {
+	f := newFakeRegistry()
+	defer f.Close()
+	ctx := context.Background()
+
+	saved := opts
+	defer func() { opts = saved }()
+	opts.journal = ""
+
+	// Both stale tags point to the same digest
+	c := pushImage(f, "mirror/c", "1.0")
+	f.putManifest("mirror/c", "latest", oci.MediaTypeImageIndex, f.manifests["mirror/c:1.0"])
+	// A tag not being pruned keeps the digest
+	d := pushImage(f, "mirror/d", "1.0")
+	f.putManifest("mirror/d", "latest", oci.MediaTypeImageIndex, f.manifests["mirror/d:1.0"])
+
+	state := &syncState{Tags: map[string]string{"c:1.0": c, "c:latest": c, "d:1.0": d}}
+	if got := pruneSynced(ctx, f.client(t), state, []string{"c:1.0", "c:latest", "d:1.0"}, "mirror"); got != 2 {
+		t.Errorf("got %d pruned; want 2", got)
+	}
+	if _, ok := f.manifests["mirror/c:"+c]; ok {
+		t.Error("mirror/c not pruned")
+	}
+	if _, ok := f.manifests["mirror/d:"+d]; !ok {
+		t.Error("mirror/d pruned")
+	}
+	if want := map[string]string{"d:1.0": d}; !reflect.DeepEqual(state.Tags, want) {
+		t.Errorf("got state %v; want %v", state.Tags, want)
+	}
+}
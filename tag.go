@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/ricardobranco777/regview/registry"
+	"github.com/ricardobranco777/regview/repoutils"
+)
+
+var reTag = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+// parseImage parses a REGISTRY/REPOSITORY[:TAG|@DIGEST] argument
+func parseImage(arg string) (domain string, repo string, ref string, err error) {
+	domain, path, err := parseImageArg(arg)
+	if err != nil {
+		return "", "", "", err
+	}
+	if path == "" {
+		return "", "", "", fmt.Errorf("%s: missing repository", arg)
+	}
+	if _, err := registry.ParseImage(domain + "/" + path); err != nil {
+		return "", "", "", fmt.Errorf("%s: %v", arg, err)
+	}
+	repo, ref, err = repoutils.GetRepoAndRef(path)
+	return domain, repo, ref, err
+}
+
+// tagImage tags SRC as DST where DST may be a tag in the same repository or another repository in the same registry
+func tagImage(ctx context.Context, src string, dst string) {
+	domain, srcRepo, srcRef, err := parseImage(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dstRepo, dstRef := srcRepo, dst
+	if strings.Contains(dst, "/") {
+		var dstDomain string
+		if dstDomain, dstRepo, dstRef, err = parseImage(dst); err != nil {
+			log.Fatal(err)
+		}
+		if dstDomain != domain {
+			log.Fatalf("%s and %s are in different registries\n", src, dst)
+		}
+	}
+	if !reTag.MatchString(dstRef) {
+		log.Fatalf("%s: invalid tag\n", dstRef)
+	}
+
+	r, err := createRegistryClient(ctx, domain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Tagging %s/%s as %s/%s:%s\n", domain, refString(srcRepo, srcRef), domain, dstRepo, dstRef)
+	if opts.dryRun {
+		return
+	}
+	c := newCopier(r, r)
+	digest, err := c.copyManifest(ctx, srcRepo, srcRef, dstRepo, dstRef)
+	if err != nil {
+		logError(ctx, "%s: %v\n", src, err)
+		return
+	}
+	fmt.Printf("%s/%s:%s@%s\n", domain, dstRepo, dstRef, digest)
+}
+
+// refString joins the repository & the tag or digest
+func refString(repo string, ref string) string {
+	if strings.Contains(ref, ":") {
+		return repo + "@" + ref
+	}
+	return repo + ":" + ref
+}
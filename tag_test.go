@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ricardobranco777/regview/oci"
+)
+
+func Test_parseImage(t *testing.T) {
+	for arg, want := range map[string][3]string{
+		"localhost:5000/repo":         {"localhost:5000", "repo", "latest"},
+		"localhost:5000/org/repo:1.0": {"localhost:5000", "org/repo", "1.0"},
+		"registry.example.com/repo@sha256:" + "0123456789012345678901234567890123456789012345678901234567890123": {"registry.example.com", "repo", "sha256:0123456789012345678901234567890123456789012345678901234567890123"},
+	} {
+		domain, repo, ref, err := parseImage(arg)
+		if err != nil || [3]string{domain, repo, ref} != want {
+			t.Errorf("parseImage(%s) got %s %s %s %v; want %v", arg, domain, repo, ref, err, want)
+		}
+	}
+
+	for _, arg := range []string{"localhost:5000", "localhost:5000/Repo"} {
+		if _, _, _, err := parseImage(arg); err == nil {
+			t.Errorf("parseImage(%s) expected error", arg)
+		}
+	}
+}
+
+// pushImage pushes a multi-arch image with a config & a layer for each platform
+func pushImage(f *fakeRegistry, repo string, tag string) string {
+	index := `{"schemaVersion":2,"mediaType":"` + oci.MediaTypeImageIndex + `","manifests":[`
+	for i, arch := range []string{"amd64", "arm64"} {
+		config := f.putBlob(repo, []byte(`{"architecture":"`+arch+`","os":"linux"}`))
+		layer := f.putBlob(repo, []byte("layer for "+arch))
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","config":{"digest":"%s","size":1},"layers":[{"digest":"%s","size":1}]}`, oci.MediaTypeImageManifest, config, layer)
+		d := f.putManifest(repo, "", oci.MediaTypeImageManifest, []byte(manifest))
+		if i > 0 {
+			index += ","
+		}
+		index += fmt.Sprintf(`{"mediaType":"%s","digest":"%s","size":%d,"platform":{"architecture":"%s","os":"linux"}}`, oci.MediaTypeImageManifest, d, len(manifest), arch)
+	}
+	return f.putManifest(repo, tag, oci.MediaTypeImageIndex, []byte(index+"]}"))
+}
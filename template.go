@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+)
+
+var (
+	reAction   = regexp.MustCompile(`{{-?\s*(.*?)\s*-?}}`)
+	reField    = regexp.MustCompile(`\.([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)`)
+	reKeywords = regexp.MustCompile(`^(if|else|end|range|with|define|template|block|break|continue)\b`)
+)
+
+// Functions available to --format
+var templateFuncs = template.FuncMap{
+	"json":  toJSON,
+	"size":  prettySize,
+	"since": since,
+	"ago":   func(v any) string { return suffix(since(v), " ago") },
+	"time":  formatTime,
+	"short": shortID,
+	"join":  strings.Join,
+	"label": label,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func suffix(s, suffix string) string {
+	if s == "" {
+		return s
+	}
+	return s + suffix
+}
+
+// since returns the human readable duration since the time
+func since(v any) string {
+	t, ok := toTime(v)
+	if !ok {
+		return ""
+	}
+	return units.HumanDuration(time.Since(t))
+}
+
+// formatTime formats the time with the layout in the local timezone
+func formatTime(layout string, v any) string {
+	t, ok := toTime(v)
+	if !ok {
+		return ""
+	}
+	return t.In(tz).Format(layout)
+}
+
+// shortID returns the first 12 characters of the digest without the algorithm
+func shortID(id string) string {
+	if _, hex, ok := strings.Cut(id, ":"); ok {
+		id = hex
+	}
+	return id[:min(len(id), 12)]
+}
+
+// label returns the value of the label for an Info, an Image or a map of labels
+func label(key string, v any) string {
+	switch v := v.(type) {
+	case *registry.Info:
+		if v != nil {
+			return label(key, v.Image)
+		}
+	case *oci.Image:
+		if v != nil {
+			return v.Config.Labels[key]
+		}
+	case map[string]string:
+		return v[key]
+	}
+	return ""
+}
+
+// parseFormat parses the --format template.  Like docker, a "table" prefix prints a header
+// and aligns the columns separated by tabs.
+func parseFormat(text string) (tmpl *template.Template, header string, err error) {
+	if text == "table" || strings.HasPrefix(text, "table ") {
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "table"), " ")
+		if text == "" {
+			text = `{{.Repo}}:{{.Ref}}\t{{short .ID}}\t{{size .Size}}`
+		}
+		text = strings.ReplaceAll(text, `\t`, "\t")
+		header = tableHeader(text)
+	}
+
+	tmpl, err = template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid format: %v", err)
+	}
+	return tmpl, header, nil
+}
+
+// tableHeader replaces each action in the template with the uppercased name of the last field it uses
+func tableHeader(text string) string {
+	return reAction.ReplaceAllStringFunc(text, func(action string) string {
+		inner := reAction.FindStringSubmatch(action)[1]
+		if reKeywords.MatchString(inner) {
+			return ""
+		}
+		m := reField.FindStringSubmatch(inner)
+		if m == nil {
+			return ""
+		}
+		fields := strings.Split(m[1], ".")
+		return strings.ToUpper(fields[len(fields)-1])
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ricardobranco777/regview/oci"
+	"github.com/ricardobranco777/regview/registry"
+)
+
+func Test_tableHeader(t *testing.T) {
+	xwant := map[string]string{
+		"{{.Repo}}:{{.Ref}}\t{{size .Size}}":                     "REPO:REF\tSIZE",
+		"{{short .ID}}\t{{.Image.Created | time \"2006\"}}":      "ID\tCREATED",
+		"{{if .Image}}{{.Image.Architecture}}{{end}}\t{{ .ID }}": "ARCHITECTURE\tID",
+		"{{label \"maintainer\" .}}\t{{\"x\"}}":                  "\t",
+	}
+
+	for text, want := range xwant {
+		if got := tableHeader(text); got != want {
+			t.Errorf("tableHeader(%q) got %q; want %q", text, got, want)
+		}
+	}
+}
+
+func Test_parseFormat(t *testing.T) {
+	var err error
+	if tz, err = time.LoadLocation("UTC"); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	info := &registry.Info{
+		Repo: "library/alpine",
+		Ref:  "3.19",
+		ID:   "sha256:0123456789abcdef",
+		Size: 3 * 1000 * 1000,
+		Image: &oci.Image{
+			Created: &created,
+			Config: oci.ImageConfig{
+				Cmd:    []string{"/bin/sh", "-c"},
+				Labels: map[string]string{"maintainer": "me"},
+			},
+		},
+	}
+
+	xwant := map[string]struct{ header, output string }{
+		`{{.Repo | upper}}:{{lower "ABC"}} {{short .ID}} {{size .Size}}`: {"", "LIBRARY/ALPINE:abc 0123456789ab 3MB"},
+		`{{json .Image.Config.Cmd}} {{join .Image.Config.Cmd " "}}`:      {"", `["/bin/sh","-c"] /bin/sh -c`},
+		`{{label "maintainer" .}} {{label "none" .Image}}|`:              {"", "me |"},
+		`{{time "2006-01-02" .Image.Created}} {{ago .Image.Created}}`:    {"", "2024-01-02 " + since(&created) + " ago"},
+		`table {{.Repo}}\t{{.Ref}}`:                                      {"REPO\tREF", "library/alpine\t3.19"},
+	}
+
+	for text, want := range xwant {
+		tmpl, header, err := parseFormat(text)
+		if err != nil {
+			t.Fatalf("parseFormat(%q): %v", text, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, info); err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		if header != want.header || buf.String() != want.output {
+			t.Errorf("%q got %q, %q; want %q, %q", text, header, buf.String(), want.header, want.output)
+		}
+	}
+
+	if _, _, err := parseFormat("{{.Repo"); err == nil {
+		t.Error("expected error for invalid format")
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"regexp"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/go-units"
 	"golang.org/x/term"
+	"mvdan.cc/sh/v3/pattern"
 )
 
 var tz *time.Location
@@ -33,6 +38,64 @@ func filterRegex(ss []string, regex *regexp.Regexp, exclude bool) []string {
 	return matched
 }
 
+// logError logs the error unless the context was cancelled and counts it for the exit code
+func logError(ctx context.Context, format string, args ...any) {
+	if ctx.Err() != nil {
+		return
+	}
+	failures.Add(1)
+	log.Printf(format, args...)
+}
+
+// logErrors logs each error joined with errors.Join
+func logErrors(ctx context.Context, prefix string, err error) {
+	if errs, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range errs.Unwrap() {
+			logErrors(ctx, prefix, err)
+		}
+		return
+	}
+	logError(ctx, "%s%v\n", prefix, err)
+}
+
+// parseImageArg splits a REGISTRY[/REPOSITORY[:TAG|@DIGEST]] argument in the registry & the image path
+func parseImageArg(arg string) (domain string, path string, err error) {
+	if !strings.HasPrefix(arg, "http:") && !strings.HasPrefix(arg, "https://") {
+		arg = "https://" + arg
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", arg, err)
+	}
+	if u.Path != "" {
+		path = strings.TrimPrefix(arg, u.Scheme+"://"+u.Host+"/")
+	}
+	return u.Host, path, nil
+}
+
+// globRegex converts a shell pattern to an anchored regular expression
+func globRegex(glob string) (*regexp.Regexp, error) {
+	expr, err := pattern.Regexp(glob, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", glob, err)
+	}
+	return regexp.MustCompile("^" + expr + "$"), nil
+}
+
+// parseDuration parses a duration also accepting days & weeks like "30d" or "2w"
+func parseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(f * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
 func getCommit() string {
 	var commit, dirty string
 
@@ -78,6 +141,14 @@ func prettySize(n int64) string {
 	return units.HumanSize(float64(n))
 }
 
+// formatSize returns the size in bytes with --raw or in human units
+func formatSize(n int64) string {
+	if opts.raw {
+		return strconv.FormatInt(n, 10)
+	}
+	return prettySize(n)
+}
+
 func prettyTime(t *time.Time) string {
 	return t.In(tz).Format(time.UnixDate)
 }
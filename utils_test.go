@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"mvdan.cc/sh/v3/pattern"
 )
@@ -41,3 +42,25 @@ func Test_getMax(t *testing.T) {
 		t.Errorf("filterRegex(%v) got %d; want %d", ss, got, want)
 	}
 }
+
+func Test_parseDuration(t *testing.T) {
+	xwant := map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"12h":  12 * time.Hour,
+	}
+
+	for s, want := range xwant {
+		got, err := parseDuration(s)
+		if err != nil || got != want {
+			t.Errorf("parseDuration(%s) got %v, %v; want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"d", "xd", "1y"} {
+		if _, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%s) expected error", s)
+		}
+	}
+}